@@ -1,7 +0,0 @@
-package main
-
-type isbnAPI interface {
-	Get(isbn string) error
-	Save(path string) error
-	Load(path string) error
-}
@@ -0,0 +1,94 @@
+package isbn
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+//書籍JANコード2段目 192(191) + Cコード4桁 + 本体価格5桁 + チェックディジット
+type BookCode struct {
+	JAN    string `json:"jan"`
+	CCode  string `json:"ccode"`
+	Target string `json:"target"`
+	Form   string `json:"form"`
+	Genre  string `json:"genre"`
+	Price  int    `json:"price"`
+}
+
+var errNotBookCode = errors.New("書籍JANコード2段目ではありません")
+
+//販売対象 Cコード1桁目
+var cCodeTarget = [10]string{"一般", "教養", "実用", "専門", "検定教科書・その他", "婦人", "学参I(小中)", "学参II(高校)", "児童", "雑誌扱い"}
+
+//発行形態 Cコード2桁目
+var cCodeForm = [10]string{"単行本", "文庫", "新書", "全集・双書", "ムック・その他", "事・辞典", "図鑑", "絵本", "磁性媒体など", "コミック"}
+
+//内容 Cコード3,4桁目
+var cCodeGenre = map[string]string{
+	"00": "総記", "01": "百科事典", "02": "年鑑・雑誌", "04": "情報科学",
+	"10": "哲学", "11": "心理学", "12": "倫理学", "14": "宗教", "15": "仏教", "16": "キリスト教",
+	"20": "歴史総記", "21": "日本歴史", "22": "外国歴史", "23": "伝記", "25": "地理", "26": "旅行",
+	"30": "社会科学総記", "31": "政治", "32": "法律", "33": "経済・財政・統計", "34": "経営", "36": "社会", "37": "教育", "39": "民族・風習",
+	"40": "自然科学総記", "41": "数学", "42": "物理学", "43": "化学", "44": "天文・地学", "45": "生物学", "47": "医学・歯学・薬学",
+	"50": "工学・工学総記", "51": "土木", "52": "建築", "53": "機械", "54": "電気", "55": "電子通信", "56": "海事", "57": "採鉱・冶金", "58": "その他の工業",
+	"60": "産業総記", "61": "農林業", "62": "水産業", "63": "商業", "65": "交通・通信",
+	"70": "芸術総記", "71": "絵画・彫刻", "72": "写真・工芸", "73": "音楽・舞踊", "74": "演劇・映画", "75": "体育・スポーツ", "76": "諸芸・娯楽", "77": "家事", "79": "コミックス・劇画",
+	"80": "語学総記", "81": "日本語", "82": "英米語", "84": "ドイツ語", "85": "フランス語", "87": "各国語",
+	"90": "文学総記", "91": "日本文学総記", "92": "日本文学詩歌", "93": "日本文学、小説・物語", "95": "日本文学、評論、随筆、その他", "97": "外国文学小説", "98": "外国文学、その他",
+}
+
+//EAN-13の文字列から書籍JANコード2段目を読み取る
+func ParseBookCode(s string) (*BookCode, error) {
+	if !strings.HasPrefix(s, "192") && !strings.HasPrefix(s, "191") {
+		return nil, errNotBookCode
+	}
+	if !validISBN13(s) {
+		return nil, fmt.Errorf("%w: %s", errNotBookCode, s)
+	}
+	c := &BookCode{JAN: s, CCode: "C" + s[3:7]}
+	c.Target = cCodeTarget[s[3]-'0']
+	c.Form = cCodeForm[s[4]-'0']
+	c.Genre = cCodeGenre[s[5:7]]
+	c.Price, _ = strconv.Atoi(s[7:12])
+	return c, nil
+}
+
+func (c *BookCode) String() string {
+	return fmt.Sprintf("%s %s/%s/%s %d円", c.CCode, c.Target, c.Form, c.Genre, c.Price)
+}
+
+//WebAPIの構造体に埋め込んでテンプレートから参照できるようにする
+func (c *BookCode) SetBookCode(n *BookCode) {
+	if n == nil {
+		*c = BookCode{}
+		return
+	}
+	*c = *n
+}
+
+//フォルダにisbn_barcode.jsonとして保存
+func (c *BookCode) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(path, "isbn_barcode.json"), data, 0644)
+}
+
+//フォルダのisbn_barcode.jsonを読む
+func LoadBookCode(path string) (*BookCode, error) {
+	data, err := ioutil.ReadFile(filepath.Join(path, "isbn_barcode.json"))
+	if err != nil {
+		return nil, err
+	}
+	c := &BookCode{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,19 @@
+package isbn
+
+import "testing"
+
+func TestParseBookCode(t *testing.T) {
+	c, err := ParseBookCode("1920979007000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.CCode != "C0979" || c.Target != "一般" || c.Form != "コミック" || c.Genre != "コミックス・劇画" || c.Price != 700 {
+		t.Errorf("ParseBookCode = %+v", c)
+	}
+	if _, err := ParseBookCode("9784088725093"); err == nil {
+		t.Error("ISBN accepted as book code")
+	}
+	if _, err := ParseBookCode("1920979007001"); err == nil {
+		t.Error("bad check digit accepted")
+	}
+}
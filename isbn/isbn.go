@@ -0,0 +1,178 @@
+//Package isbn ISBNと書籍JANコード2段目の解析
+package isbn
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+//ISBN 13桁に正規化されたISBN番号
+type ISBN string
+
+var errInvalidISBN = errors.New("不正なISBNです")
+
+//ISBNらしい数字の並び ハイフン区切りも含む
+var isbnCandidate = regexp.MustCompile(`\d[\d\-]{8,}[\dXx]`)
+
+//ISBN10/13の文字列を検証して13桁に正規化する
+func Parse(s string) (ISBN, error) {
+	s = strings.TrimSpace(s)
+	if len(s) > 4 && strings.EqualFold(s[:4], "ISBN") {
+		s = strings.TrimLeft(s[4:], ":：- ")
+	}
+	s = strings.Map(func(r rune) rune {
+		switch r {
+		case '-', ' ', '‐', '－':
+			return -1
+		case 'x':
+			return 'X'
+		}
+		return r
+	}, s)
+
+	switch len(s) {
+	case 10:
+		if !validISBN10(s) {
+			return "", fmt.Errorf("%w: %s", errInvalidISBN, s)
+		}
+		return isbn10to13(s), nil
+	case 13:
+		if !validISBN13(s) {
+			return "", fmt.Errorf("%w: %s", errInvalidISBN, s)
+		}
+		if !strings.HasPrefix(s, "978") && !strings.HasPrefix(s, "979") {
+			return "", fmt.Errorf("%w: 978,979で始まりません %s", errInvalidISBN, s)
+		}
+		return ISBN(s), nil
+	}
+	return "", fmt.Errorf("%w: 桁数が違います %s", errInvalidISBN, s)
+}
+
+//文字列からチェックディジットが正しいISBNを全て探す
+func Find(s string) []ISBN {
+	var list []ISBN
+	seen := map[ISBN]bool{}
+	for _, isbn := range FindAll(s) {
+		if !seen[isbn] {
+			seen[isbn] = true
+			list = append(list, isbn)
+		}
+	}
+	return list
+}
+
+//Findと同じだが、同じISBNも現れた回数だけ返す
+func FindAll(s string) []ISBN {
+	var list []ISBN
+	for _, txt := range isbnCandidate.FindAllString(s, -1) {
+		if isbn, err := Parse(txt); err == nil {
+			list = append(list, isbn)
+			continue
+		}
+		list = append(list, findInGroups(txt)...)
+	}
+	return list
+}
+
+//"2020-9784088725093"のように隣の数字とつながった並びから
+//ハイフンの区切りごとに13桁、10桁になる範囲を探す
+func findInGroups(txt string) []ISBN {
+	var groups []string
+	for _, g := range strings.Split(txt, "-") {
+		if g != "" {
+			groups = append(groups, g)
+		}
+	}
+	var list []ISBN
+	for i := 0; i < len(groups); {
+		next := i + 1
+		digits := ""
+		for j := i; j < len(groups) && len(digits) < 13; j++ {
+			digits += groups[j]
+			if len(digits) != 10 && len(digits) != 13 {
+				continue
+			}
+			if isbn, err := Parse(digits); err == nil {
+				list = append(list, isbn)
+				next = j + 1
+				break
+			}
+		}
+		i = next
+	}
+	return list
+}
+
+func (isbn ISBN) String() string {
+	return string(isbn)
+}
+
+//ISBN10に変換 979で始まる場合は空文字
+func (isbn ISBN) ISBN10() string {
+	s := string(isbn)
+	if len(s) != 13 || !strings.HasPrefix(s, "978") {
+		return ""
+	}
+	body := s[3:12]
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += int(body[i]-'0') * (10 - i)
+	}
+	check := (11 - sum%11) % 11
+	if check == 10 {
+		return body + "X"
+	}
+	return body + string(rune('0'+check))
+}
+
+func isbn10to13(s string) ISBN {
+	body := "978" + s[:9]
+	return ISBN(body + string(rune('0'+ean13CheckDigit(body))))
+}
+
+func validISBN10(s string) bool {
+	if len(s) != 10 {
+		return false
+	}
+	sum := 0
+	for i := 0; i < 10; i++ {
+		var n int
+		switch {
+		case s[i] >= '0' && s[i] <= '9':
+			n = int(s[i] - '0')
+		case s[i] == 'X' && i == 9:
+			n = 10
+		default:
+			return false
+		}
+		sum += n * (10 - i)
+	}
+	return sum%11 == 0
+}
+
+func validISBN13(s string) bool {
+	if len(s) != 13 {
+		return false
+	}
+	for i := 0; i < 13; i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return ean13CheckDigit(s[:12]) == int(s[12]-'0')
+}
+
+//EAN-13のチェックディジット 12桁を渡す
+func ean13CheckDigit(s string) int {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		n := int(s[i] - '0')
+		if i%2 == 1 {
+			n *= 3
+		}
+		sum += n
+	}
+	return (10 - sum%10) % 10
+}
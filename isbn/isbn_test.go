@@ -0,0 +1,60 @@
+package isbn
+
+import "testing"
+
+func TestParseISBN(t *testing.T) {
+	tests := []struct {
+		in   string
+		want ISBN
+		ok   bool
+	}{
+		{"9784088725093", "9784088725093", true},
+		{"978-4-08-872509-3", "9784088725093", true},
+		{"ISBN 978 4 08 872509 3", "9784088725093", true},
+		{"4088725093", "9784088725093", true},
+		{"4-08-872509-3", "9784088725093", true},
+		{"080442957x", "9780804429573", true},
+		{"9784088725094", "", false},
+		{"4088725094", "", false},
+		{"1234567890128", "", false},
+		{"19201234", "", false},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if (err == nil) != tt.ok {
+			t.Errorf("parseISBN(%q) err = %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseISBN(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestISBN10(t *testing.T) {
+	if got := ISBN("9780804429573").ISBN10(); got != "080442957X" {
+		t.Errorf("ISBN10() = %q", got)
+	}
+	if got := ISBN("9791032305690").ISBN10(); got != "" {
+		t.Errorf("ISBN10() of 979 = %q", got)
+	}
+}
+
+func TestFindISBNs(t *testing.T) {
+	got := Find("[作者] タイトル 2020 [ISBN 9784088725094] [ISBN 978-4-08-872509-3] 4088725093")
+	if len(got) != 1 || got[0] != "9784088725093" {
+		t.Errorf("findISBNs = %v", got)
+	}
+	for _, s := range []string{"2020-9784088725093", "vol-01-978-4-08-872509-3"} {
+		if got := Find(s); len(got) != 1 || got[0] != "9784088725093" {
+			t.Errorf("Find(%q) = %v", s, got)
+		}
+	}
+}
+
+func TestFindAll(t *testing.T) {
+	got := FindAll("URL=https://www.amazon.co.jp/dp/4088725093/ref=sr_1_1 isbn=978-4-08-872509-3&x=1 9784088725094")
+	if len(got) != 2 || got[0] != "9784088725093" || got[1] != "9784088725093" {
+		t.Errorf("FindAll = %v", got)
+	}
+}
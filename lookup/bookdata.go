@@ -0,0 +1,36 @@
+//Package lookup ISBNから書誌情報を取得するWebAPI
+package lookup
+
+import (
+	"context"
+	"strings"
+
+	"github.com/y9o/isbn2title/isbn"
+)
+
+type API interface {
+	Get(ctx context.Context, isbn string) error
+	Save(path string) error
+	Load(path string) error
+	Record() *BookRecord //Get,Loadで読んだ書誌情報
+}
+
+//書籍JANコード2段目をテンプレートから参照できるAPI
+type BookCodeSetter interface {
+	SetBookCode(n *isbn.BookCode)
+}
+
+//openbd,google,kokkai,openlibrary またはそれ以外の名前は「名前.yml」のWebサイト定義
+func New(name string) (API, error) {
+	switch strings.ToLower(name) {
+	case "openbd":
+		return &OpenbdAPI{}, nil
+	case "google":
+		return &GoogleAPI{}, nil
+	case "kokkai":
+		return &KokkaiAPI{}, nil
+	case "openlibrary":
+		return &OpenLibraryAPI{}, nil
+	}
+	return NewWebSite(name + ".yml")
+}
@@ -0,0 +1,187 @@
+package lookup
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+//WebAPIの応答のキャッシュ API名/ISBN に本文をそのまま保存する
+//見つからなかったISBNは API名/ISBN.miss を残して、MissTTLの間は問い合わせない
+type Cache struct {
+	Dir     string
+	TTL     time.Duration //これより古い本文は使わない 0なら無期限
+	MissTTL time.Duration //見つからなかった記録の有効期間 0なら無期限
+	Offline bool          //WebAPIに接続せずキャッシュだけを使う 期限切れも使う
+}
+
+var (
+	ErrOffline    = errors.New("オフラインのためキャッシュにありません")
+	errCachedMiss = errors.New("見つかりませんでした(キャッシュ)")
+)
+
+//見つからなかった記録の拡張子
+const missExt = ".miss"
+
+//キャッシュフォルダの初期値
+func DefaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "isbn2title", "api")
+}
+
+func (c *Cache) path(provider, isbn string) string {
+	return filepath.Join(c.Dir, url.PathEscape(strings.ToLower(provider)), url.PathEscape(isbn))
+}
+
+//期限内か Offlineなら期限切れも使う
+func (c *Cache) fresh(path string, ttl time.Duration) bool {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return c.Offline || ttl <= 0 || time.Since(stat.ModTime()) < ttl
+}
+
+//キャッシュにあれば本文 見つからなかった記録ならerrCachedMiss
+func (c *Cache) get(provider, isbn string) ([]byte, bool, error) {
+	if c == nil {
+		return nil, false, nil
+	}
+	path := c.path(provider, isbn)
+	if c.fresh(path+missExt, c.MissTTL) {
+		return nil, true, errCachedMiss
+	}
+	if !c.fresh(path, c.TTL) {
+		return nil, false, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, false, nil
+	}
+	return data, true, nil
+}
+
+func (c *Cache) put(provider, isbn string, data []byte) error {
+	if c == nil {
+		return nil
+	}
+	path := c.path(provider, isbn)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	os.Remove(path + missExt)
+	return writeFileAtomic(path, data)
+}
+
+func (c *Cache) putMiss(provider, isbn string) error {
+	if c == nil {
+		return nil
+	}
+	path := c.path(provider, isbn)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	os.Remove(path)
+	return writeFileAtomic(path+missExt, nil)
+}
+
+//一時ファイルに書いてから置き換える 同時に読む他のプロセスに書きかけの本文を見せない
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+//期限切れの本文と記録、空になったAPIのフォルダを削除して、削除したファイルの数を返す
+func (c *Cache) Prune() (int, error) {
+	dirs, err := ioutil.ReadDir(c.Dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		dir := filepath.Join(c.Dir, d.Name())
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return n, err
+		}
+		left := len(files)
+		for _, f := range files {
+			ttl := c.TTL
+			if strings.HasSuffix(f.Name(), missExt) {
+				ttl = c.MissTTL
+			}
+			if ttl <= 0 || time.Since(f.ModTime()) < ttl {
+				continue
+			}
+			if err := os.Remove(filepath.Join(dir, f.Name())); err != nil {
+				return n, err
+			}
+			n++
+			left--
+		}
+		if left == 0 {
+			os.Remove(dir)
+		}
+	}
+	return n, nil
+}
+
+//キャッシュ、なければWebAPIから取得してparseする
+//parseできたものは本文を、404とparseできなかったものは見つからなかった記録を残す
+func (c *Client) fetch(ctx context.Context, provider, isbn, rawurl string, header http.Header, data *[]byte, parse func() error) error {
+	if body, ok, err := c.Cache.get(provider, isbn); ok {
+		if err != nil {
+			return err
+		}
+		*data = body
+		return parse()
+	}
+	if c.Cache != nil && c.Cache.Offline {
+		return ErrOffline
+	}
+	body, err := c.Get(ctx, rawurl, header)
+	if se, ok := err.(*StatusError); ok && se.StatusCode == http.StatusNotFound {
+		c.Cache.putMiss(provider, isbn)
+	}
+	if err != nil {
+		return err
+	}
+	*data = body
+	if err := parse(); err != nil {
+		c.Cache.putMiss(provider, isbn)
+		return err
+	}
+	//キャッシュに書けなくても取得はできている
+	c.Cache.put(provider, isbn, body)
+	return nil
+}
@@ -0,0 +1,92 @@
+package lookup
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "isbn2title")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		switch r.URL.Query().Get("isbn") {
+		case "9784088725093":
+			w.Write([]byte(testOpenbd))
+		case "9780804429573":
+			w.Write([]byte("[null]"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	cache := &Cache{Dir: dir, TTL: time.Hour, MissTTL: time.Hour}
+	client := testClient()
+	client.Cache = cache
+	get := func(isbn string) error {
+		return (&OpenbdAPI{Client: client, BaseURL: srv.URL}).Get(context.Background(), isbn)
+	}
+	for i := 0; i < 2; i++ {
+		if err := get("9784088725093"); err != nil {
+			t.Fatal(err)
+		}
+		if err := get("9780804429573"); err == nil {
+			t.Error("unknown format accepted")
+		}
+		if err := get("9784000000000"); err == nil {
+			t.Error("404 accepted")
+		}
+	}
+	if calls != 3 {
+		t.Errorf("calls = %d", calls)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "openbd", "9780804429573.miss")); err != nil {
+		t.Error(err)
+	}
+
+	//オフラインではキャッシュにないものは問い合わせない
+	cache.Offline = true
+	if err := get("9784088725093"); err != nil {
+		t.Error(err)
+	}
+	if err := get("9791000000000"); !errors.Is(err, ErrOffline) || calls != 3 {
+		t.Errorf("offline: %v calls=%d", err, calls)
+	}
+	cache.Offline = false
+
+	//期限切れを削除すると問い合わせ直す
+	old := time.Now().Add(-2 * time.Hour)
+	os.Chtimes(filepath.Join(dir, "openbd", "9784088725093"), old, old)
+	cache.MissTTL = 0
+	if n, err := cache.Prune(); err != nil || n != 1 {
+		t.Errorf("Prune = %d, %v", n, err)
+	}
+	if err := get("9784088725093"); err != nil || calls != 4 {
+		t.Errorf("after prune: %v calls=%d", err, calls)
+	}
+	//書き込み用の一時ファイルは残らない
+	files, err := ioutil.ReadDir(filepath.Join(dir, "openbd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		if strings.HasSuffix(f.Name(), ".tmp") {
+			t.Errorf("unexpected file %s", f.Name())
+		}
+	}
+}
@@ -1,12 +1,12 @@
-package main
+package lookup
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
-	"net/http"
 	"path/filepath"
-	"strings"
 )
 
 type googlebd struct {
@@ -21,6 +21,7 @@ type googlebd struct {
 			Title               string   `json:"title"`
 			Subtitle            string   `json:"subtitle"`
 			Authors             []string `json:"authors"`
+			Publisher           string   `json:"publisher"`
 			PublishedDate       string   `json:"publishedDate"`
 			Description         string   `json:"description"`
 			IndustryIdentifiers []struct {
@@ -31,11 +32,12 @@ type googlebd struct {
 				Text  bool `json:"text"`
 				Image bool `json:"image"`
 			} `json:"readingModes"`
-			PageCount        int    `json:"pageCount"`
-			PrintType        string `json:"printType"`
-			MaturityRating   string `json:"maturityRating"`
-			AllowAnonLogging bool   `json:"allowAnonLogging"`
-			ContentVersion   string `json:"contentVersion"`
+			PageCount        int      `json:"pageCount"`
+			Categories       []string `json:"categories"`
+			PrintType        string   `json:"printType"`
+			MaturityRating   string   `json:"maturityRating"`
+			AllowAnonLogging bool     `json:"allowAnonLogging"`
+			ContentVersion   string   `json:"contentVersion"`
 			ImageLinks       struct {
 				SmallThumbnail string `json:"smallThumbnail"`
 				Thumbnail      string `json:"thumbnail"`
@@ -72,36 +74,29 @@ type googlebd struct {
 	} `json:"items"`
 }
 
-type googleAPI struct {
-	Google    googlebd
-	data      []byte
-	Title     string
-	Author    string
-	Publisher string
-	Pubdate   string
-	ISBN      string
+type GoogleAPI struct {
+	Google googlebd
+	data   []byte
+	BookRecord
+	Client  *Client //nilならDefaultClient
+	BaseURL string  //接続先のscheme,hostを置き換える テスト用
 }
 
-func (bd *googleAPI) Get(isbn string) error {
-	resp, err := http.Get("https://www.googleapis.com/books/v1/volumes?q=isbn:" + isbn)
+func (bd *GoogleAPI) Get(ctx context.Context, isbn string) error {
+	u, err := rebase("https://www.googleapis.com/books/v1/volumes?q=isbn:"+isbn, bd.BaseURL)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-	bd.data, err = ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return err
-	}
-	if resp.StatusCode != 200 {
-		return errors.New("Google response: " + resp.Status)
+	if err := clientOf(bd.Client).fetch(ctx, "google", isbn, u, nil, &bd.data, bd.parse); err != nil {
+		return fmt.Errorf("Google %w", err)
 	}
-	return bd.parse()
+	return nil
 }
-func (bd *googleAPI) Save(path string) error {
+func (bd *GoogleAPI) Save(path string) error {
 	json := filepath.Join(path, "isbn_google.json")
 	return ioutil.WriteFile(json, bd.data, 0644)
 }
-func (bd *googleAPI) Load(path string) (err error) {
+func (bd *GoogleAPI) Load(path string) (err error) {
 	json := filepath.Join(path, "isbn_google.json")
 	bd.data, err = ioutil.ReadFile(json)
 	if err != nil {
@@ -111,7 +106,8 @@ func (bd *googleAPI) Load(path string) (err error) {
 	return
 }
 
-func (bd *googleAPI) parse() error {
+func (bd *GoogleAPI) parse() error {
+	bd.reset()
 	if err := json.Unmarshal(bd.data, &bd.Google); err != nil {
 		return err
 	}
@@ -120,20 +116,31 @@ func (bd *googleAPI) parse() error {
 		return errors.New("googlebd unknown format")
 	}
 	for _, item := range bd.Google.Items {
-		if len(item.VolumeInfo.Authors) == 0 || item.VolumeInfo.Title == "" {
+		info := item.VolumeInfo
+		if len(info.Authors) == 0 || info.Title == "" {
 			continue
 		}
-		bd.Title = item.VolumeInfo.Title
-		if item.VolumeInfo.Subtitle != "" {
-			bd.Title += " " + item.VolumeInfo.Subtitle
+		bd.Title = info.Title
+		bd.Subtitle = info.Subtitle
+		if info.Subtitle != "" {
+			bd.Title += " " + info.Subtitle
+		}
+		for _, name := range info.Authors {
+			bd.Contributors = append(bd.Contributors, Contributor{Name: name, Role: RoleAuthor})
 		}
-		bd.Author = strings.ReplaceAll(strings.Join(bd.Google.Items[0].VolumeInfo.Authors, "／"), " ", "")
-		bd.Pubdate = item.VolumeInfo.PublishedDate
-		for _, isbn := range item.VolumeInfo.IndustryIdentifiers {
+		bd.joinAuthors()
+		bd.Publisher = info.Publisher
+		bd.Pubdate = normalizeDate(info.PublishedDate)
+		for _, isbn := range info.IndustryIdentifiers {
 			if bd.ISBN == "" || isbn.Type == "ISBN_13" {
-				bd.ISBN = isbn.Identifier
+				bd.ISBN = normalizeISBN(isbn.Identifier)
 			}
 		}
+		bd.Language = normalizeLanguage(info.Language)
+		bd.Pages = info.PageCount
+		bd.Cover = info.ImageLinks.Thumbnail
+		bd.Subjects = info.Categories
+		break
 	}
 	return nil
 }
@@ -0,0 +1,135 @@
+package lookup
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//WebAPIへの接続 各APIのClientがnilならDefaultClientを使う
+type Client struct {
+	HTTP      *http.Client  //nilなら接続を使い回す共有のクライアント
+	Timeout   time.Duration //1回のリクエストの制限時間 0なら無制限
+	Retries   int           //5xx,429のときに再試行する回数
+	Backoff   time.Duration //最初の再試行までの待ち時間 再試行のたびに倍にする
+	UserAgent string
+	Cache     *Cache //nilならキャッシュしない
+}
+
+var DefaultClient = &Client{Timeout: 30 * time.Second, Retries: 2, Backoff: time.Second}
+
+//gzipは透過的に展開し、keep-aliveの接続を使い回す
+var sharedHTTP = &http.Client{Transport: newTransport()}
+
+func newTransport() http.RoundTripper {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConnsPerHost = 4
+	return t
+}
+
+//200以外の応答
+type StatusError struct {
+	URL        string
+	Status     string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return "response: " + e.Status
+}
+
+//再試行する応答か
+func (e *StatusError) temporary() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests
+}
+
+func clientOf(c *Client) *Client {
+	if c == nil {
+		return DefaultClient
+	}
+	return c
+}
+
+//GETして本文を返す 200以外は*StatusError
+//5xx,429は待ち時間を倍にしながら再試行する Retry-Afterの秒数が長ければそれだけ待つ
+func (c *Client) Get(ctx context.Context, rawurl string, header http.Header) ([]byte, error) {
+	wait := c.Backoff
+	for n := 0; ; n++ {
+		body, retryAfter, err := c.get(ctx, rawurl, header)
+		se, ok := err.(*StatusError)
+		if !ok || !se.temporary() || n >= c.Retries {
+			return body, err
+		}
+		if retryAfter > wait {
+			wait = retryAfter
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		wait *= 2
+	}
+}
+
+func (c *Client) get(ctx context.Context, rawurl string, header http.Header) ([]byte, time.Duration, error) {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequest("GET", rawurl, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req = req.WithContext(ctx)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if c.UserAgent != "" && req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+	hc := c.HTTP
+	if hc == nil {
+		hc = sharedHTTP
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	//最後まで読んで閉じると接続を使い回せる
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		retryAfter, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		return body, time.Duration(retryAfter) * time.Second, &StatusError{URL: rawurl, Status: resp.Status, StatusCode: resp.StatusCode}
+	}
+	return body, 0, nil
+}
+
+//rawurlのscheme,hostをbaseのものに置き換える baseが空ならそのまま
+func rebase(rawurl, base string) (string, error) {
+	if base == "" {
+		return rawurl, nil
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "", err
+	}
+	b, err := url.Parse(base)
+	if err != nil {
+		return "", fmt.Errorf("BaseURL: %w", err)
+	}
+	u.Scheme = b.Scheme
+	u.Host = b.Host
+	u.Path = strings.TrimSuffix(b.Path, "/") + u.Path
+	return u.String(), nil
+}
@@ -0,0 +1,140 @@
+package lookup
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testClient() *Client {
+	return &Client{Timeout: time.Second, Retries: 2, Backoff: time.Millisecond}
+}
+
+func TestClientRetry(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&calls, 1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+	defer srv.Close()
+
+	body, err := testClient().Get(context.Background(), srv.URL, nil)
+	if err != nil || string(body) != "ok" || calls != 3 {
+		t.Errorf("Get = %q, %v, calls=%d", body, err, calls)
+	}
+
+	//再試行しきれなければ最後の応答
+	atomic.StoreInt32(&calls, 0)
+	c := testClient()
+	c.Retries = 1
+	_, err = c.Get(context.Background(), srv.URL, nil)
+	var se *StatusError
+	if !errors.As(err, &se) || se.StatusCode != http.StatusTooManyRequests || calls != 2 {
+		t.Errorf("Get = %v, calls=%d", err, calls)
+	}
+}
+
+func TestClientNotFound(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	_, err := testClient().Get(context.Background(), srv.URL, nil)
+	var se *StatusError
+	if !errors.As(err, &se) || se.StatusCode != http.StatusNotFound || calls != 1 {
+		t.Errorf("Get = %v, calls=%d", err, calls)
+	}
+}
+
+func TestClientGzip(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") || r.Header.Get("User-Agent") != "test-agent" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		zw.Write([]byte("compressed"))
+		zw.Close()
+	}))
+	defer srv.Close()
+
+	body, err := testClient().Get(context.Background(), srv.URL, http.Header{"User-Agent": {"test-agent"}})
+	if err != nil || string(body) != "compressed" {
+		t.Errorf("Get = %q, %v", body, err)
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	c := testClient()
+	c.Timeout = 50 * time.Millisecond
+	start := time.Now()
+	if _, err := c.Get(context.Background(), srv.URL, nil); err == nil || time.Since(start) > 5*time.Second {
+		t.Errorf("timeout: %v %s", err, time.Since(start))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := testClient().Get(ctx, srv.URL, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled: %v", err)
+	}
+}
+
+func TestProviderBaseURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v1/get" && r.URL.Query().Get("isbn") == "9784088725093":
+			w.Write([]byte(testOpenbd))
+		case r.URL.Path == "/books/v1/volumes" && r.URL.Query().Get("q") == "isbn:9784088725093":
+			w.Write([]byte(testGoogle))
+		case r.URL.Path == "/api/opensearch":
+			w.Write([]byte(testKokkai))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	for _, api := range []API{
+		&OpenbdAPI{Client: testClient(), BaseURL: srv.URL},
+		&GoogleAPI{Client: testClient(), BaseURL: srv.URL + "/"},
+		&KokkaiAPI{Client: testClient(), BaseURL: srv.URL},
+	} {
+		if err := api.Get(context.Background(), "9784088725093"); err != nil {
+			t.Errorf("%T: %s", api, err)
+			continue
+		}
+		if r := api.Record(); r.ISBN != "9784088725093" || r.Publisher != "集英社" {
+			t.Errorf("%T: %+v", api, r)
+		}
+	}
+	api := &OpenbdAPI{Client: testClient(), BaseURL: srv.URL}
+	if err := api.Get(context.Background(), "4088725093"); err == nil || !strings.HasPrefix(err.Error(), "OpenBD response: 404") {
+		t.Errorf("not found: %v", err)
+	}
+}
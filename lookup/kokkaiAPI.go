@@ -1,10 +1,11 @@
-package main
+package lookup
 
 import (
+	"context"
 	"encoding/xml"
 	"errors"
+	"fmt"
 	"io/ioutil"
-	"net/http"
 	"path/filepath"
 )
 
@@ -49,6 +50,7 @@ type kokkaibd struct {
 				Text string `xml:",chardata"`
 				Type string `xml:"type,attr"`
 			} `xml:"issued"`
+			Language   string   `xml:"language"`
 			Extent     []string `xml:"extent"`
 			Identifier []struct {
 				Text string `xml:",chardata"`
@@ -74,36 +76,29 @@ type kokkaibd struct {
 	} `xml:"channel"`
 }
 
-type kokkaiAPI struct {
-	Kokkai    kokkaibd
-	data      []byte
-	Title     string
-	Author    string
-	Publisher string
-	Pubdate   string
-	ISBN      string
+type KokkaiAPI struct {
+	Kokkai kokkaibd
+	data   []byte
+	BookRecord
+	Client  *Client //nilならDefaultClient
+	BaseURL string  //接続先のscheme,hostを置き換える テスト用
 }
 
-func (bd *kokkaiAPI) Get(isbn string) error {
-	resp, err := http.Get("http://iss.ndl.go.jp/api/opensearch?isbn=" + isbn)
+func (bd *KokkaiAPI) Get(ctx context.Context, isbn string) error {
+	u, err := rebase("http://iss.ndl.go.jp/api/opensearch?isbn="+isbn, bd.BaseURL)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-	bd.data, err = ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return err
-	}
-	if resp.StatusCode != 200 {
-		return errors.New("Response: " + resp.Status)
+	if err := clientOf(bd.Client).fetch(ctx, "kokkai", isbn, u, nil, &bd.data, bd.parse); err != nil {
+		return fmt.Errorf("Kokkai %w", err)
 	}
-	return bd.parse()
+	return nil
 }
-func (bd *kokkaiAPI) Save(path string) error {
+func (bd *KokkaiAPI) Save(path string) error {
 	json := filepath.Join(path, "isbn_kokkai.xml")
 	return ioutil.WriteFile(json, bd.data, 0644)
 }
-func (bd *kokkaiAPI) Load(path string) (err error) {
+func (bd *KokkaiAPI) Load(path string) (err error) {
 	json := filepath.Join(path, "isbn_kokkai.xml")
 	bd.data, err = ioutil.ReadFile(json)
 	if err != nil {
@@ -113,7 +108,8 @@ func (bd *kokkaiAPI) Load(path string) (err error) {
 	return
 }
 
-func (bd *kokkaiAPI) parse() error {
+func (bd *KokkaiAPI) parse() error {
+	bd.reset()
 	if err := xml.Unmarshal(bd.data, &bd.Kokkai); err != nil {
 		return err
 	}
@@ -129,21 +125,33 @@ func (bd *kokkaiAPI) parse() error {
 			continue
 		}
 		bd.Author = item.Author
+		bd.Contributors = []Contributor{{Name: item.Author, Role: RoleAuthor}}
 		bd.Title = item.Title
+		bd.Series = item.SeriesTitle
+		bd.Volume = item.Volume
 		bd.Publisher = item.Publisher
 		for _, isbn := range item.Identifier {
 			if isbn.Type == "dcndl:ISBN" && len(bd.ISBN) != 13 {
-				bd.ISBN = isbn.Text
+				bd.ISBN = normalizeISBN(isbn.Text)
 			}
 		}
 		for _, v := range item.Issued {
 			if v.Type == "dcterms:W3CDTF" {
-				bd.Pubdate = v.Text
+				bd.Pubdate = normalizeDate(v.Text)
 			}
 		}
 		if item.Volume != "" {
 			bd.Title += " " + item.Volume
 		}
+		bd.Language = normalizeLanguage(item.Language)
+		for _, v := range item.Extent {
+			if n := parsePages(v); n > 0 {
+				bd.Pages = n
+			}
+		}
+		for _, v := range item.Subject {
+			bd.Subjects = append(bd.Subjects, v.Text)
+		}
 		return nil
 	}
 	//title,authorが空白ならエラー
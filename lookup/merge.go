@@ -0,0 +1,108 @@
+package lookup
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+//Mergeする1つのAPIの結果
+type Source struct {
+	Name   string //openbd,googleなど -APIに書いた名前
+	Record *BookRecord
+}
+
+//欄ごとのAPIの優先順 書かれていないAPIはその後にSourcesの順
+type Precedence map[string][]string
+
+var errPrecedence = errors.New("-mergeOrderは Pubdate=kokkai,google;Title=openbd のように指定してください")
+
+//"Pubdate=kokkai,google;Title=openbd" 欄の名前は大文字小文字を区別しない
+func ParsePrecedence(s string) (Precedence, error) {
+	p := Precedence{}
+	for _, v := range strings.Split(s, ";") {
+		if strings.TrimSpace(v) == "" {
+			continue
+		}
+		kv := strings.SplitN(v, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("%w: %s", errPrecedence, v)
+		}
+		field, ok := recordField(strings.TrimSpace(kv[0]))
+		if !ok {
+			return nil, fmt.Errorf("%w: 不明な欄 %s", errPrecedence, kv[0])
+		}
+		for _, name := range strings.Split(kv[1], ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				p[field] = append(p[field], strings.ToLower(name))
+			}
+		}
+	}
+	return p, nil
+}
+
+//BookRecordの欄の名前 2段目と出典は除く
+func recordFields() []string {
+	var list []string
+	t := reflect.TypeOf(BookRecord{})
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Name == "Code" || f.Name == "Provenance" {
+			continue
+		}
+		list = append(list, f.Name)
+	}
+	return list
+}
+
+func recordField(name string) (string, bool) {
+	for _, f := range recordFields() {
+		if strings.EqualFold(f, name) {
+			return f, true
+		}
+	}
+	return "", false
+}
+
+//欄の優先順 Precedenceに書かれたAPI、その後にsourcesの順
+func (p Precedence) order(field string, sources []Source) []Source {
+	var list []Source
+	used := make([]bool, len(sources))
+	for _, name := range p[field] {
+		for i, src := range sources {
+			if !used[i] && strings.EqualFold(src.Name, name) {
+				used[i] = true
+				list = append(list, src)
+			}
+		}
+	}
+	for i, src := range sources {
+		if !used[i] {
+			list = append(list, src)
+		}
+	}
+	return list
+}
+
+//複数のAPIの結果を欄ごとに優先順で空でない値を選んで1つにする
+//どのAPIの値を使ったかはProvenanceに残す
+func Merge(sources []Source, p Precedence) *BookRecord {
+	merged := &BookRecord{Provenance: map[string]string{}}
+	dst := reflect.ValueOf(merged).Elem()
+	for _, field := range recordFields() {
+		for _, src := range p.order(field, sources) {
+			if src.Record == nil {
+				continue
+			}
+			v := reflect.ValueOf(src.Record).Elem().FieldByName(field)
+			if v.IsZero() {
+				continue
+			}
+			dst.FieldByName(field).Set(v)
+			merged.Provenance[field] = src.Name
+			break
+		}
+	}
+	return merged
+}
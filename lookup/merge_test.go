@@ -0,0 +1,38 @@
+package lookup
+
+import "testing"
+
+func TestMerge(t *testing.T) {
+	p, err := ParsePrecedence("pubdate=kokkai; Title = openbd,google")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParsePrecedence("Price=openbd"); err == nil {
+		t.Error("ParsePrecedence accepted unknown field")
+	}
+	sources := []Source{
+		{"google", &BookRecord{Title: "ONE PIECE Vol.1", Author: "OdaEiichiro", Pubdate: "1997-12", Pages: 192}},
+		{"openbd", &BookRecord{Title: "ONE PIECE 1", Author: "尾田栄一郎", Publisher: "集英社"}},
+		{"kokkai", &BookRecord{Title: "ONE PIECE", Pubdate: "1997-12-24"}},
+		{"calilWEB", nil},
+	}
+	rec := Merge(sources, p)
+	want := map[string]string{
+		"Title":     "openbd",
+		"Author":    "google",
+		"Publisher": "openbd",
+		"Pubdate":   "kokkai",
+		"Pages":     "google",
+	}
+	if rec.Title != "ONE PIECE 1" || rec.Author != "OdaEiichiro" || rec.Publisher != "集英社" || rec.Pubdate != "1997-12-24" || rec.Pages != 192 {
+		t.Errorf("Merge = %+v", rec)
+	}
+	if len(rec.Provenance) != len(want) {
+		t.Errorf("Provenance = %v", rec.Provenance)
+	}
+	for field, from := range want {
+		if rec.Provenance[field] != from {
+			t.Errorf("Provenance[%s] = %q, want %q", field, rec.Provenance[field], from)
+		}
+	}
+}
@@ -1,12 +1,13 @@
-package main
+package lookup
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
-	"net/http"
 	"path/filepath"
-	"strings"
+	"strconv"
 )
 
 type openbd []struct {
@@ -161,36 +162,29 @@ type openbd []struct {
 	} `json:"summary"`
 }
 
-type openbdAPI struct {
-	OpenBD    openbd
-	data      []byte
-	Title     string
-	Author    string
-	Publisher string
-	Pubdate   string
-	ISBN      string
+type OpenbdAPI struct {
+	OpenBD openbd
+	data   []byte
+	BookRecord
+	Client  *Client //nilならDefaultClient
+	BaseURL string  //接続先のscheme,hostを置き換える テスト用
 }
 
-func (bd *openbdAPI) Get(isbn string) error {
-	resp, err := http.Get("https://api.openbd.jp/v1/get?pretty&isbn=" + isbn)
+func (bd *OpenbdAPI) Get(ctx context.Context, isbn string) error {
+	u, err := rebase("https://api.openbd.jp/v1/get?pretty&isbn="+isbn, bd.BaseURL)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-	bd.data, err = ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return err
+	if err := clientOf(bd.Client).fetch(ctx, "openbd", isbn, u, nil, &bd.data, bd.parse); err != nil {
+		return fmt.Errorf("OpenBD %w", err)
 	}
-	if resp.StatusCode != 200 {
-		return errors.New("OpenBD response: " + resp.Status)
-	}
-	return bd.parse()
+	return nil
 }
-func (bd *openbdAPI) Save(path string) error {
+func (bd *OpenbdAPI) Save(path string) error {
 	json := filepath.Join(path, "isbn_openbd.json")
 	return ioutil.WriteFile(json, bd.data, 0644)
 }
-func (bd *openbdAPI) Load(path string) (err error) {
+func (bd *OpenbdAPI) Load(path string) (err error) {
 	json := filepath.Join(path, "isbn_openbd.json")
 	bd.data, err = ioutil.ReadFile(json)
 	if err != nil {
@@ -200,7 +194,17 @@ func (bd *openbdAPI) Load(path string) (err error) {
 	return
 }
 
-func (bd *openbdAPI) parse() error {
+//ONIXのContributorRole
+var onixRoles = map[string]string{
+	"A01": RoleAuthor,
+	"A12": RoleIllustrator,
+	"A38": RoleOriginal,
+	"B01": RoleEditor,
+	"B06": RoleTranslator,
+}
+
+func (bd *OpenbdAPI) parse() error {
+	bd.reset()
 	if err := json.Unmarshal(bd.data, &bd.OpenBD); err != nil {
 		return err
 	}
@@ -208,22 +212,48 @@ func (bd *openbdAPI) parse() error {
 		if item.Summary.Author == "" || item.Summary.Title == "" {
 			continue
 		}
+		detail := item.Onix.DescriptiveDetail
 		bd.Title = item.Summary.Title
+		bd.Subtitle = detail.TitleDetail.TitleElement.Subtitle.Content
+		bd.Series = item.Summary.Series
+		bd.Volume = item.Summary.Volume
 		bd.Publisher = item.Summary.Publisher
 		if item.Summary.Volume != "" {
 			bd.Title += " " + item.Summary.Volume
 		}
-		var a []string
-		for _, con := range item.Onix.DescriptiveDetail.Contributor {
-			a = append(a, con.PersonName.Content)
+		for _, con := range detail.Contributor {
+			c := Contributor{Name: con.PersonName.Content}
+			if len(con.ContributorRole) > 0 {
+				c.Role = con.ContributorRole[0]
+				if role, ok := onixRoles[c.Role]; ok {
+					c.Role = role
+				}
+			}
+			bd.Contributors = append(bd.Contributors, c)
 		}
-		bd.Author = strings.ReplaceAll(strings.Join(a, "／"), " ", "")
+		bd.joinAuthors()
 		if bd.Author == "" {
 			bd.Author = item.Summary.Author
 		}
 
-		bd.Pubdate = item.Summary.Pubdate
-		bd.ISBN = item.Summary.Isbn
+		bd.Pubdate = normalizeDate(item.Summary.Pubdate)
+		bd.ISBN = normalizeISBN(item.Summary.Isbn)
+		for _, v := range detail.Language {
+			bd.Language = normalizeLanguage(v.LanguageCode)
+			break
+		}
+		for _, v := range detail.Extent {
+			//11:ページ数
+			if v.ExtentType == "11" {
+				bd.Pages, _ = strconv.Atoi(v.ExtentValue)
+			}
+		}
+		bd.Cover = item.Summary.Cover
+		for _, v := range detail.Subject {
+			if v.SubjectCode != "" {
+				bd.Subjects = append(bd.Subjects, v.SubjectCode)
+			}
+		}
 		return nil
 	}
 	//title,authorが空白ならエラー
@@ -0,0 +1,300 @@
+package lookup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+//Open Libraryの/isbn/{isbn}.json
+type openlibraryEdition struct {
+	Key      string `json:"key"`
+	Title    string `json:"title"`
+	Subtitle string `json:"subtitle"`
+	Authors  []struct {
+		Key string `json:"key"`
+	} `json:"authors"`
+	Publishers    []string `json:"publishers"`
+	PublishDate   string   `json:"publish_date"`
+	NumberOfPages int      `json:"number_of_pages"`
+	Languages     []struct {
+		Key string `json:"key"`
+	} `json:"languages"`
+	Covers   []int    `json:"covers"`
+	Subjects []string `json:"subjects"`
+	Series   []string `json:"series"`
+	ISBN13   []string `json:"isbn_13"`
+	ISBN10   []string `json:"isbn_10"`
+	Works    []struct {
+		Key string `json:"key"`
+	} `json:"works"`
+}
+
+//Open Libraryの/api/books?jscmd=data 1冊分
+type openlibraryBook struct {
+	URL      string `json:"url"`
+	Title    string `json:"title"`
+	Subtitle string `json:"subtitle"`
+	Authors  []struct {
+		URL  string `json:"url"`
+		Name string `json:"name"`
+	} `json:"authors"`
+	Publishers []struct {
+		Name string `json:"name"`
+	} `json:"publishers"`
+	PublishDate   string `json:"publish_date"`
+	NumberOfPages int    `json:"number_of_pages"`
+	Subjects      []struct {
+		Name string `json:"name"`
+		URL  string `json:"url"`
+	} `json:"subjects"`
+	Cover struct {
+		Small  string `json:"small"`
+		Medium string `json:"medium"`
+		Large  string `json:"large"`
+	} `json:"cover"`
+}
+
+//isbn_openlibrary.jsonに保存する形 2つの応答と著者の名前
+type openlibraryData struct {
+	Edition json.RawMessage   `json:"edition"`
+	Books   json.RawMessage   `json:"books,omitempty"`
+	Authors map[string]string `json:"authors,omitempty"` //著者のキー(/authors/OL..A) => 名前
+}
+
+type openlibrary struct {
+	Edition openlibraryEdition
+	Book    openlibraryBook
+	Authors map[string]string
+}
+
+type OpenLibraryAPI struct {
+	OpenLibrary openlibrary
+	data        []byte
+	BookRecord
+	Client  *Client //nilならDefaultClient
+	BaseURL string  //接続先のscheme,hostを置き換える テスト用
+}
+
+const openlibraryURL = "https://openlibrary.org"
+
+//表紙画像 /api/booksになければeditionのcoversから
+const openlibraryCoverURL = "https://covers.openlibrary.org/b/id/%d-M.jpg"
+
+func (bd *OpenLibraryAPI) url(p string) (string, error) {
+	return rebase(openlibraryURL+p, bd.BaseURL)
+}
+
+//editionを取得して、/api/booksと著者の名前で補う
+//booksと著者の名前が取得できなくてもeditionがあれば成功
+func (bd *OpenLibraryAPI) Get(ctx context.Context, isbn string) error {
+	c := clientOf(bd.Client)
+	var raw openlibraryData
+	u, err := bd.url("/isbn/" + url.PathEscape(isbn) + ".json")
+	if err != nil {
+		return err
+	}
+	var edition openlibraryEdition
+	if err := c.fetch(ctx, "openlibrary", isbn, u, nil, (*[]byte)(&raw.Edition), func() error {
+		return parseOpenlibraryEdition(raw.Edition, &edition)
+	}); err != nil {
+		return fmt.Errorf("OpenLibrary %w", err)
+	}
+
+	var book openlibraryBook
+	u, err = bd.url("/api/books?format=json&jscmd=data&bibkeys=ISBN:" + url.QueryEscape(isbn))
+	if err != nil {
+		return err
+	}
+	if err := c.fetch(ctx, "openlibrary-books", isbn, u, nil, (*[]byte)(&raw.Books), func() error {
+		return parseOpenlibraryBooks(raw.Books, &book)
+	}); err != nil {
+		raw.Books = nil
+	}
+
+	raw.Authors = map[string]string{}
+	for _, a := range book.Authors {
+		raw.Authors[openlibraryAuthorKey(a.URL)] = a.Name
+	}
+	for _, a := range edition.Authors {
+		if raw.Authors[a.Key] != "" {
+			continue
+		}
+		if name, err := bd.authorName(ctx, c, a.Key); err == nil {
+			raw.Authors[a.Key] = name
+		}
+	}
+
+	bd.data, err = json.MarshalIndent(raw, "", "  ")
+	if err != nil {
+		return err
+	}
+	return bd.parse()
+}
+
+//著者のキーから名前を取得
+func (bd *OpenLibraryAPI) authorName(ctx context.Context, c *Client, key string) (string, error) {
+	u, err := bd.url(key + ".json")
+	if err != nil {
+		return "", err
+	}
+	var data []byte
+	var author struct {
+		Name string `json:"name"`
+	}
+	err = c.fetch(ctx, "openlibrary-authors", path.Base(key), u, nil, &data, func() error {
+		if err := json.Unmarshal(data, &author); err != nil {
+			return err
+		}
+		if author.Name == "" {
+			return errors.New("author name not found")
+		}
+		return nil
+	})
+	return author.Name, err
+}
+
+//https://openlibrary.org/authors/OL34184A/Roald_Dahl => /authors/OL34184A
+func openlibraryAuthorKey(u string) string {
+	i := strings.Index(u, "/authors/")
+	if i < 0 {
+		return u
+	}
+	key := u[i:]
+	if parts := strings.SplitN(key, "/", 4); len(parts) > 3 {
+		key = strings.Join(parts[:3], "/")
+	}
+	return key
+}
+
+func parseOpenlibraryEdition(data []byte, edition *openlibraryEdition) error {
+	if err := json.Unmarshal(data, edition); err != nil {
+		return err
+	}
+	//titleが空白ならエラー
+	if edition.Title == "" {
+		return errors.New("openlibraryAPI unknown format")
+	}
+	return nil
+}
+
+//bibkeysに1冊だけ指定した応答 見つからなければ{}
+func parseOpenlibraryBooks(data []byte, book *openlibraryBook) error {
+	var books map[string]openlibraryBook
+	if err := json.Unmarshal(data, &books); err != nil {
+		return err
+	}
+	for _, v := range books {
+		*book = v
+		return nil
+	}
+	return errors.New("openlibrary books not found")
+}
+
+func (bd *OpenLibraryAPI) Save(path string) error {
+	json := filepath.Join(path, "isbn_openlibrary.json")
+	return ioutil.WriteFile(json, bd.data, 0644)
+}
+func (bd *OpenLibraryAPI) Load(path string) (err error) {
+	json := filepath.Join(path, "isbn_openlibrary.json")
+	bd.data, err = ioutil.ReadFile(json)
+	if err != nil {
+		return
+	}
+	err = bd.parse()
+	return
+}
+
+func (bd *OpenLibraryAPI) parse() error {
+	bd.reset()
+	var raw openlibraryData
+	if err := json.Unmarshal(bd.data, &raw); err != nil {
+		return err
+	}
+	ol := openlibrary{Authors: raw.Authors}
+	if err := parseOpenlibraryEdition(raw.Edition, &ol.Edition); err != nil {
+		return err
+	}
+	if len(raw.Books) > 0 {
+		parseOpenlibraryBooks(raw.Books, &ol.Book)
+	}
+	bd.OpenLibrary = ol
+	ed := ol.Edition
+
+	bd.Title = ed.Title
+	bd.Subtitle = ed.Subtitle
+	if ed.Subtitle != "" {
+		bd.Title += " " + ed.Subtitle
+	}
+	if len(ed.Series) > 0 {
+		bd.Series = ed.Series[0]
+	}
+	for _, a := range ed.Authors {
+		if name := ol.Authors[a.Key]; name != "" {
+			bd.Contributors = append(bd.Contributors, Contributor{Name: name, Role: RoleAuthor})
+		}
+	}
+	if len(bd.Contributors) == 0 {
+		for _, a := range ol.Book.Authors {
+			bd.Contributors = append(bd.Contributors, Contributor{Name: a.Name, Role: RoleAuthor})
+		}
+	}
+	//英語の名前が多いので空白は残す
+	var names []string
+	for _, c := range bd.Contributors {
+		names = append(names, c.Name)
+	}
+	bd.Author = strings.Join(names, "／")
+	if len(ed.Publishers) > 0 {
+		bd.Publisher = ed.Publishers[0]
+	}
+	bd.Pubdate = openlibraryDate(ed.PublishDate)
+	switch {
+	case len(ed.ISBN13) > 0:
+		bd.ISBN = normalizeISBN(ed.ISBN13[0])
+	case len(ed.ISBN10) > 0:
+		bd.ISBN = normalizeISBN(ed.ISBN10[0])
+	}
+	if len(ed.Languages) > 0 {
+		bd.Language = normalizeLanguage(path.Base(ed.Languages[0].Key))
+	}
+	bd.Pages = ed.NumberOfPages
+	if bd.Pages == 0 {
+		bd.Pages = ol.Book.NumberOfPages
+	}
+	if ol.Book.Cover.Medium != "" {
+		bd.Cover = ol.Book.Cover.Medium
+	} else if len(ed.Covers) > 0 && ed.Covers[0] > 0 {
+		bd.Cover = fmt.Sprintf(openlibraryCoverURL, ed.Covers[0])
+	}
+	bd.Subjects = ed.Subjects
+	if len(bd.Subjects) == 0 {
+		for _, s := range ol.Book.Subjects {
+			bd.Subjects = append(bd.Subjects, s.Name)
+		}
+	}
+	return nil
+}
+
+//"October 1, 1988"のような英語の日付
+var openlibraryDateLayouts = []string{"January 2, 2006", "Jan 2, 2006", "2 January 2006", "January 2006", "Jan 2006"}
+
+func openlibraryDate(s string) string {
+	s = strings.TrimSpace(s)
+	for _, layout := range openlibraryDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			if strings.Contains(layout, "2,") || strings.HasPrefix(layout, "2 ") {
+				return t.Format("2006-01-02")
+			}
+			return t.Format("2006-01")
+		}
+	}
+	return normalizeDate(s)
+}
@@ -0,0 +1,112 @@
+package lookup
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+//Open Libraryの応答を記録したtestdata/openlibraryを返すサーバー
+func openlibraryServer(t *testing.T, authors *int) *httptest.Server {
+	fixture := func(w http.ResponseWriter, name string) {
+		data, err := ioutil.ReadFile(filepath.Join("testdata", "openlibrary", name))
+		if err != nil {
+			t.Error(err)
+			http.NotFound(w, nil)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/isbn/9780140328721.json":
+			//本物と同じくeditionのURLへ転送する
+			http.Redirect(w, r, "/books/OL7353617M.json", http.StatusFound)
+		case "/books/OL7353617M.json":
+			fixture(w, "isbn_9780140328721.json")
+		case "/api/books":
+			if r.URL.Query().Get("bibkeys") == "ISBN:9780140328721" && r.URL.Query().Get("jscmd") == "data" {
+				fixture(w, "books_9780140328721.json")
+			} else {
+				fixture(w, "books_empty.json")
+			}
+		case "/authors/OL34184A.json":
+			*authors++
+			fixture(w, "OL34184A.json")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestOpenLibrary(t *testing.T) {
+	var authors int
+	srv := openlibraryServer(t, &authors)
+	defer srv.Close()
+
+	want := BookRecord{
+		Title: "Fantastic Mr. Fox", Author: "Roald Dahl",
+		Contributors: []Contributor{{"Roald Dahl", RoleAuthor}},
+		Publisher:    "Puffin", Pubdate: "1988-10-01", ISBN: "9780140328721", Language: "en", Pages: 96,
+		Cover:    "https://covers.openlibrary.org/b/id/8739161-M.jpg",
+		Subjects: []string{"Animals", "Foxes", "Children's fiction"},
+	}
+	api, err := New("openlibrary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ol := api.(*OpenLibraryAPI)
+	ol.Client, ol.BaseURL = testClient(), srv.URL
+	if err := api.Get(context.Background(), "9780140328721"); err != nil {
+		t.Fatal(err)
+	}
+	if got := api.Record(); !reflect.DeepEqual(*got, want) {
+		t.Errorf("Get:\n got %+v\nwant %+v", *got, want)
+	}
+	//booksに名前があれば著者を問い合わせない
+	if authors != 0 {
+		t.Errorf("authors = %d", authors)
+	}
+
+	dir, err := ioutil.TempDir("", "isbn2title")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := api.Save(dir); err != nil {
+		t.Fatal(err)
+	}
+	loaded := &OpenLibraryAPI{}
+	if err := loaded.Load(dir); err != nil {
+		t.Fatal(err)
+	}
+	if got := loaded.Record(); !reflect.DeepEqual(*got, want) {
+		t.Errorf("Load:\n got %+v\nwant %+v", *got, want)
+	}
+
+	if err := (&OpenLibraryAPI{Client: testClient(), BaseURL: srv.URL}).Get(context.Background(), "9784088725093"); err == nil {
+		t.Error("unknown isbn accepted")
+	}
+}
+
+func TestOpenLibraryAuthorKey(t *testing.T) {
+	var authors int
+	srv := openlibraryServer(t, &authors)
+	defer srv.Close()
+
+	//booksがなければ著者のキーから名前を取得する
+	api := &OpenLibraryAPI{Client: testClient(), BaseURL: srv.URL}
+	name, err := api.authorName(context.Background(), api.Client, "/authors/OL34184A")
+	if err != nil || name != "Roald Dahl" || authors != 1 {
+		t.Errorf("authorName = %q, %v, %d", name, err, authors)
+	}
+	if got := openlibraryAuthorKey("https://openlibrary.org/authors/OL34184A/Roald_Dahl"); got != "/authors/OL34184A" {
+		t.Errorf("openlibraryAuthorKey = %q", got)
+	}
+}
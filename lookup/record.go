@@ -0,0 +1,144 @@
+package lookup
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/y9o/isbn2title/isbn"
+)
+
+//どのAPIでも同じ形に正規化した書誌情報
+//各APIはこれを埋め込むので、テンプレートからは{{.Title}}のように参照できる
+type BookRecord struct {
+	Code         isbn.BookCode `json:"-"` //書籍JANコード2段目 SetBookCodeで設定する
+	Title        string        //巻数、サブタイトルを含むタイトル
+	Subtitle     string        `json:",omitempty"`
+	Series       string        `json:",omitempty"`
+	Volume       string        `json:",omitempty"`
+	Author       string        //著者を／で連結 openlibrary以外は空白を除く
+	Contributors []Contributor `json:",omitempty"`
+	Publisher    string
+	Pubdate      string            //YYYY-MM-DD、YYYY-MM、YYYY
+	ISBN         string            //13桁
+	Language     string            `json:",omitempty"` //ja,enなど
+	Pages        int               `json:",omitempty"`
+	Cover        string            `json:",omitempty"` //表紙画像のURL
+	Subjects     []string          `json:",omitempty"`
+	Provenance   map[string]string `json:",omitempty"` //欄ごとに値を取得したAPI Mergeのみ
+}
+
+//著者、編者など
+type Contributor struct {
+	Name string
+	Role string //author,editor,illustrator,translator,original またはAPIの値そのまま
+}
+
+//Contributor.Role
+const (
+	RoleAuthor      = "author"
+	RoleEditor      = "editor"
+	RoleIllustrator = "illustrator"
+	RoleTranslator  = "translator"
+	RoleOriginal    = "original"
+)
+
+func (r *BookRecord) Record() *BookRecord {
+	return r
+}
+
+//取得したデータを捨てる 2段目は残す
+func (r *BookRecord) reset() {
+	*r = BookRecord{Code: r.Code}
+}
+
+//書籍JANコード2段目を設定する nilなら消す
+func (r *BookRecord) SetBookCode(n *isbn.BookCode) {
+	if n == nil {
+		r.Code = isbn.BookCode{}
+		return
+	}
+	r.Code = *n
+}
+
+//テンプレートから{{.CCode}}のように2段目を参照する
+func (r *BookRecord) CCode() string  { return r.Code.CCode }
+func (r *BookRecord) Target() string { return r.Code.Target }
+func (r *BookRecord) Form() string   { return r.Code.Form }
+func (r *BookRecord) Genre() string  { return r.Code.Genre }
+func (r *BookRecord) Price() int     { return r.Code.Price }
+
+//Contributorsから著者を／で連結する
+func (r *BookRecord) joinAuthors() {
+	var a []string
+	for _, c := range r.Contributors {
+		a = append(a, c.Name)
+	}
+	r.Author = strings.ReplaceAll(strings.Join(a, "／"), " ", "")
+}
+
+//正規化した書誌情報をisbn_record.jsonとして保存
+func SaveRecord(path string, r *BookRecord) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(path, "isbn_record.json"), data, 0644)
+}
+
+var dateDigits = regexp.MustCompile(`(\d{4})(?:[-./年]?(\d{1,2}))?(?:[-./月]?(\d{1,2}))?`)
+
+//20101104、2010.11、2010年11月4日などをYYYY-MM-DD、YYYY-MM、YYYYにする 読めなければそのまま
+func normalizeDate(s string) string {
+	s = strings.TrimSpace(s)
+	m := dateDigits.FindStringSubmatch(s)
+	if m == nil {
+		return s
+	}
+	out := m[1]
+	for _, v := range m[2:] {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			break
+		}
+		out += fmt.Sprintf("-%02d", n)
+	}
+	return out
+}
+
+//13桁にする ISBNでなければそのまま
+func normalizeISBN(s string) string {
+	if id, err := isbn.Parse(s); err == nil {
+		return id.String()
+	}
+	return strings.TrimSpace(s)
+}
+
+//ISO 639-2の3文字をISO 639-1の2文字にする
+var languageCodes = map[string]string{
+	"jpn": "ja", "eng": "en", "chi": "zh", "zho": "zh", "kor": "ko",
+	"fre": "fr", "fra": "fr", "ger": "de", "deu": "de", "spa": "es", "ita": "it", "rus": "ru",
+}
+
+func normalizeLanguage(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if v, ok := languageCodes[s]; ok {
+		return v
+	}
+	return s
+}
+
+var pageCount = regexp.MustCompile(`(\d+)\s*(?:p|ページ|頁)`)
+
+//"191p ; 18cm"などからページ数
+func parsePages(s string) int {
+	if m := pageCount.FindStringSubmatch(s); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		return n
+	}
+	return 0
+}
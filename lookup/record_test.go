@@ -0,0 +1,119 @@
+package lookup
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+	"text/template"
+
+	"github.com/y9o/isbn2title/isbn"
+)
+
+const testOpenbd = `[{"onix":{"DescriptiveDetail":{
+  "TitleDetail":{"TitleElement":{"TitleText":{"content":"ONE PIECE"}}},
+  "Contributor":[{"ContributorRole":["A01"],"PersonName":{"content":"尾田 栄一郎"}}],
+  "Language":[{"LanguageRole":"01","LanguageCode":"jpn"}],
+  "Extent":[{"ExtentType":"11","ExtentValue":"192"}],
+  "Subject":[{"SubjectSchemeIdentifier":"78","SubjectCode":"0979"}]}},
+ "summary":{"isbn":"9784088725093","title":"ONE PIECE","volume":"1","series":"ジャンプ・コミックス",
+  "publisher":"集英社","pubdate":"19971224","cover":"https://cover.openbd.jp/9784088725093.jpg","author":"尾田栄一郎／著"}}]`
+
+const testGoogle = `{"totalItems":1,"items":[{"volumeInfo":{"title":"ONE PIECE","subtitle":"1",
+  "authors":["尾田 栄一郎"],"publisher":"集英社","publishedDate":"1997-12",
+  "industryIdentifiers":[{"type":"ISBN_10","identifier":"4088725093"},{"type":"ISBN_13","identifier":"9784088725093"}],
+  "pageCount":192,"categories":["Comics & Graphic Novels"],"language":"ja",
+  "imageLinks":{"thumbnail":"http://books.google.com/books/content?id=x"}}}]}`
+
+const testKokkai = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:dcterms="http://purl.org/dc/terms/" xmlns:dcndl="http://ndl.go.jp/dcndl/terms/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+<channel><item>
+  <title>ONE PIECE</title><author>尾田栄一郎 著</author><category>本</category>
+  <dc:publisher>集英社</dc:publisher><dcterms:issued xsi:type="dcterms:W3CDTF">1997.12</dcterms:issued>
+  <dc:language>jpn</dc:language><dc:extent>1冊 ; 192p ; 18cm</dc:extent>
+  <dc:identifier xsi:type="dcndl:ISBN">4-08-872509-3</dc:identifier>
+  <dc:subject>漫画</dc:subject><dcndl:seriesTitle>ジャンプ・コミックス</dcndl:seriesTitle><dcndl:volume>1</dcndl:volume>
+</item></channel></rss>`
+
+func TestBookRecord(t *testing.T) {
+	tests := []struct {
+		api  interface{ parse() error }
+		body string
+		want BookRecord
+	}{
+		{&OpenbdAPI{}, testOpenbd, BookRecord{
+			Title: "ONE PIECE 1", Series: "ジャンプ・コミックス", Volume: "1", Author: "尾田栄一郎",
+			Contributors: []Contributor{{"尾田 栄一郎", RoleAuthor}},
+			Publisher:    "集英社", Pubdate: "1997-12-24", ISBN: "9784088725093", Language: "ja", Pages: 192,
+			Cover: "https://cover.openbd.jp/9784088725093.jpg", Subjects: []string{"0979"},
+		}},
+		{&GoogleAPI{}, testGoogle, BookRecord{
+			Title: "ONE PIECE 1", Subtitle: "1", Author: "尾田栄一郎",
+			Contributors: []Contributor{{"尾田 栄一郎", RoleAuthor}},
+			Publisher:    "集英社", Pubdate: "1997-12", ISBN: "9784088725093", Language: "ja", Pages: 192,
+			Cover: "http://books.google.com/books/content?id=x", Subjects: []string{"Comics & Graphic Novels"},
+		}},
+		{&KokkaiAPI{}, testKokkai, BookRecord{
+			Title: "ONE PIECE 1", Series: "ジャンプ・コミックス", Volume: "1", Author: "尾田栄一郎 著",
+			Contributors: []Contributor{{"尾田栄一郎 著", RoleAuthor}},
+			Publisher:    "集英社", Pubdate: "1997-12", ISBN: "9784088725093", Language: "ja", Pages: 192,
+			Subjects: []string{"漫画"},
+		}},
+	}
+	for _, tt := range tests {
+		switch api := tt.api.(type) {
+		case *OpenbdAPI:
+			api.data = []byte(tt.body)
+		case *GoogleAPI:
+			api.data = []byte(tt.body)
+		case *KokkaiAPI:
+			api.data = []byte(tt.body)
+		}
+		if err := tt.api.parse(); err != nil {
+			t.Errorf("%T: %s", tt.api, err)
+			continue
+		}
+		if got := tt.api.(API).Record(); !reflect.DeepEqual(*got, tt.want) {
+			t.Errorf("%T:\n got %+v\nwant %+v", tt.api, *got, tt.want)
+		}
+	}
+}
+
+//2段目はテンプレートから参照でき、parseしても残る
+func TestBookRecordCode(t *testing.T) {
+	code, err := isbn.ParseBookCode("1920979004009")
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := &OpenbdAPI{data: []byte(testOpenbd)}
+	api.SetBookCode(code)
+	if err := api.parse(); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	tmpl := template.Must(template.New("").Parse("{{.CCode}} {{.Target}}/{{.Form}}/{{.Genre}} {{.Price}}"))
+	if err := tmpl.Execute(&buf, api); err != nil || buf.String() != "C0979 一般/コミック/コミックス・劇画 400" {
+		t.Errorf("template = %q, %v", buf.String(), err)
+	}
+	if _, ok := interface{}(api).(fmt.Stringer); ok {
+		t.Error("BookCode.String is promoted")
+	}
+}
+
+func TestNormalizeDate(t *testing.T) {
+	for in, want := range map[string]string{
+		"20101104":    "2010-11-04",
+		"2010.1":      "2010-01",
+		"2010年11月4日":  "2010-11-04",
+		"(2010)":      "2010",
+		"2010-11-04":  "2010-11-04",
+		"2010-00":     "2010",
+		"unknown":     "unknown",
+		" 1997.12 ":   "1997-12",
+		"1997/12/24 ": "1997-12-24",
+	} {
+		if got := normalizeDate(in); got != want {
+			t.Errorf("normalizeDate(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -1,7 +1,8 @@
-package main
+package lookup
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -12,6 +13,8 @@ import (
 
 	"github.com/antchfx/htmlquery"
 	"gopkg.in/yaml.v2"
+
+	"github.com/y9o/isbn2title/isbn"
 )
 
 type siteRegexp struct {
@@ -45,19 +48,17 @@ type parseSite struct {
 	} `yaml:"Parse"`
 }
 
-type webSite struct {
-	file      string
-	web       parseSite
-	data      []byte
-	Title     string
-	Author    string
-	Publisher string
-	Pubdate   string
-	ISBN      string
+type WebSite struct {
+	file string
+	web  parseSite
+	data []byte
+	BookRecord
+	Client  *Client //nilならDefaultClient
+	BaseURL string  //接続先のscheme,hostを置き換える テスト用
 }
 
-func NewWebSite(file string) (*webSite, error) {
-	ret := &webSite{file: file}
+func NewWebSite(file string) (*WebSite, error) {
+	ret := &WebSite{file: file}
 	data, err := ioutil.ReadFile(file)
 	if err != nil {
 		return nil, err
@@ -93,37 +94,34 @@ func NewWebSite(file string) (*webSite, error) {
 	return ret, nil
 }
 
-func (bd *webSite) Get(isbn string) error {
-	url := strings.Replace(bd.web.URL, "{{.ISBN}}", isbn, -1)
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", url, nil)
+func (bd *WebSite) Get(ctx context.Context, isbn string) error {
+	u, err := rebase(strings.Replace(bd.web.URL, "{{.ISBN}}", isbn, -1), bd.BaseURL)
 	if err != nil {
 		return err
 	}
+	var header http.Header
 	if bd.web.UserAgent != "" {
-		req.Header.Set("User-Agent", bd.web.UserAgent)
-	}
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
-	}
-	bd.data, err = ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return err
+		header = http.Header{"User-Agent": {bd.web.UserAgent}}
 	}
-	if resp.StatusCode != 200 {
-		return errors.New("Response: " + resp.Status)
+	if err := clientOf(bd.Client).fetch(ctx, bd.name(), isbn, u, header, &bd.data, bd.parse); err != nil {
+		return fmt.Errorf("%s %w", bd.file, err)
 	}
-	return bd.parse()
+	return nil
+}
+
+//キャッシュの名前 ymlファイルの名前
+func (bd *WebSite) name() string {
+	return strings.TrimSuffix(filepath.Base(bd.file), filepath.Ext(bd.file))
 }
-func (bd *webSite) Save(path string) error {
+
+func (bd *WebSite) Save(path string) error {
 	if bd.web.File == "" {
 		return errors.New("YamlファイルにFileが設定されていません。")
 	}
 	json := filepath.Join(path, bd.web.File)
 	return ioutil.WriteFile(json, bd.data, 0644)
 }
-func (bd *webSite) Load(path string) (err error) {
+func (bd *WebSite) Load(path string) (err error) {
 	if bd.web.File == "" {
 		return errors.New("YamlファイルにFileが設定されていません。")
 	}
@@ -136,7 +134,8 @@ func (bd *webSite) Load(path string) (err error) {
 	return
 }
 
-func (bd *webSite) parse() error {
+func (bd *WebSite) parse() error {
+	bd.reset()
 	doc, err := htmlquery.Parse(bytes.NewReader(bd.data))
 	if err != nil {
 		return err
@@ -152,6 +151,9 @@ func (bd *webSite) parse() error {
 		}
 	}
 	bd.Author = strings.Join(author, bd.web.Parse.Author.Join)
+	for _, name := range author {
+		bd.Contributors = append(bd.Contributors, Contributor{Name: name, Role: RoleAuthor})
+	}
 
 	var title []string
 	for _, item := range bd.web.Parse.Title.XPath {
@@ -184,7 +186,7 @@ func (bd *webSite) parse() error {
 			str := strings.TrimSpace(htmlquery.InnerText(tmp))
 			str = bd.web.Parse.Pubdate.Regexp.Replace(str)
 			if str != "" {
-				bd.Pubdate = str
+				bd.Pubdate = normalizeDate(str)
 				break
 			}
 		}
@@ -192,24 +194,12 @@ func (bd *webSite) parse() error {
 			break
 		}
 	}
-	var number = regexp.MustCompile(`[\d\-]{9,}[xX]?`)
-	var numberonly = regexp.MustCompile(`-`)
 	for _, item := range bd.web.Parse.ISBN.XPath {
 		list := htmlquery.Find(doc, item)
 		for _, tmp := range list {
-			str := htmlquery.InnerText(tmp)
-			for _, n := range number.FindAllString(str, -1) {
-				n = numberonly.ReplaceAllString(n, "")
-				if len(n) == 10 {
-					bd.ISBN = n
-					break
-				}
-				if len(n) == 13 && (n[12] != 'x' && n[12] != 'X') {
-					bd.ISBN = n
-					break
-				}
-			}
-			if bd.ISBN != "" {
+			//チェックディジットが正しい最初の番号
+			if isbns := isbn.Find(htmlquery.InnerText(tmp)); len(isbns) > 0 {
+				bd.ISBN = isbns[0].String()
 				break
 			}
 		}
@@ -2,93 +2,191 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"image"
-	_ "image/jpeg"
-	_ "image/png"
 	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
 	"reflect"
-	"regexp"
+	"runtime"
+	"sort"
 	"strings"
 	"text/template"
+	"time"
 
-	_ "golang.org/x/image/bmp"
-
-	"github.com/makiuchi-d/gozxing"
-	"github.com/makiuchi-d/gozxing/oned"
+	"github.com/y9o/isbn2title/isbn"
+	"github.com/y9o/isbn2title/lookup"
+	"github.com/y9o/isbn2title/scan"
 )
 
 type option struct {
-	row        int
+	scan       scan.Options
 	input      string
-	headCount  int
-	tailCount  int
-	noRotate   bool
+	rotations  string
+	strategy   string
+	preprocess string
+	roi        string
+	metadata   string
+	include    string
+	exclude    string
+	choose     string
+	debugDir   string
+	cachePath  string
 	noAccess   bool
 	noRename   bool
 	save       bool
 	test       bool
 	rename     string
-	ISBN       string
+	ISBN       isbn.ISBN
+	code       *isbn.BookCode
 	API        string
 	check      string
 	checknames bool
+	apiCache   lookup.Cache
+	pruneCache bool
+	merge      bool
+	mergeOrder string
+	precedence lookup.Precedence
 }
 
-var isbnScanner = oned.NewEAN13Reader()
-
 func main() {
 	var op option
-	flag.IntVar(&op.row, "row", 100, "画像を上下に分割してスキャン")
-	flag.IntVar(&op.headCount, "head", 5, "見つかるまでスキャンするファイルの数")
-	flag.IntVar(&op.tailCount, "tail", 5, "フォルダ内の最後尾から見つかるまでスキャンするファイルの数")
-	flag.BoolVar(&op.noRotate, "noRotate", false, "横向き画像を想定した、回転して再スキャンをしない")
+	flag.IntVar(&op.scan.Row, "row", 100, "画像を上下に分割してスキャン")
+	flag.IntVar(&op.scan.Head, "head", 5, "見つかるまでスキャンするファイルの数")
+	flag.IntVar(&op.scan.Tail, "tail", 5, "フォルダ内の最後尾から見つかるまでスキャンするファイルの数")
+	flag.StringVar(&op.strategy, "strategy", "row", "スキャン方法 row:-rowで上下に分割 window:縮小画像と重なり合う窓でスキャン")
+	flag.StringVar(&op.preprocess, "preprocess", "", "見つからない場合に画像処理して再スキャン levels,sharpen,shrink,global(二値化),hybrid(二値化)")
+	flag.StringVar(&op.roi, "roi", "", "最初にスキャンする範囲 top-right,bottom-rightなど、またはx0,y0,x1,y1の割合 見つからなければ全体")
+	flag.StringVar(&op.metadata, "metadata", "comicinfo,opf,nfo", "スキャンする前にISBNを探すメタデータと順番 ComicInfo.xml,*.opf,*.nfo 空にすると探さない")
+	flag.BoolVar(&op.scan.Harvest, "harvest", false, "スキャンする前にフォルダ内の.txt,.url,.html,.mdに書かれたISBNを探し、最も多く現れたものを使う")
+	flag.StringVar(&op.include, "include", "", "スキャンするファイル名のパターン ,区切り 例:\"*.jpg\"")
+	flag.StringVar(&op.exclude, "exclude", "", "スキャンしないファイル名のパターン ,区切り 例:\"*_thumb*\"")
+	flag.IntVar(&op.scan.MinSize, "minSize", 300, "長辺がこれより小さい画像はスキャンしない 0で無制限")
+	flag.IntVar(&op.scan.MaxPixels, "maxPixels", 60000000, "画素数がこれより多い画像は読みながら縮小してスキャン 0で無制限")
+	flag.BoolVar(&op.scan.Exhaustive, "exhaustive", false, "見つかった後もスキャンを続け、すべてのバーコードを表示する")
+	flag.StringVar(&op.choose, "choose", scan.ChooseVotes, "-exhaustiveで複数のISBNが見つかった場合の選び方 votes:読めた回数 first:最初の画像 prompt:入力")
+	flag.IntVar(&op.scan.Confirm, "confirm", 1, "ISBNとして認める、同じ値が読めた範囲の数 足りなければ確度が低いとして使わない")
+	flag.StringVar(&op.debugDir, "debug", "", "スキャンした範囲を描いた画像、二値化した帯、デコードの記録(scan_debug.json)を保存するフォルダ")
+	flag.StringVar(&op.cachePath, "scanCache", scan.DefaultCachePath(), "画像ごとのスキャン結果を保存するファイル 空にするとキャッシュしない")
+	flag.BoolVar(&op.scan.Rescan, "rescan", false, "スキャン結果のキャッシュを使わずにスキャンし直す")
+	flag.IntVar(&op.scan.Jobs, "jobs", runtime.NumCPU(), "同時にスキャンする画像の数")
+	flag.BoolVar(&op.scan.NoRotate, "noRotate", false, "横向き画像を想定した、回転して再スキャンをしない")
+	flag.StringVar(&op.rotations, "rotations", "0,90", "スキャンする向き 0,90,180,270 skewを加えると±15度までの傾きを補正して再スキャン")
 	flag.BoolVar(&op.noAccess, "noAccess", false, "ISBN取得後、WebAPIに接続せず終了する")
 	flag.BoolVar(&op.noRename, "noRename", false, "WebAPIから取得後、フォルダ名を変更しない")
 	flag.BoolVar(&op.save, "save", false, "WebAPIから取得したデータをファイルに保存する")
 	flag.BoolVar(&op.test, "test", false, "保存されたデータを読み込んで-renameをテスト")
 	flag.StringVar(&op.rename, "rename", "[{{.Author}}] {{.Title}} {{with .Publisher}}[{{.}}]{{end}}{{with .Pubdate}}[{{.}}]{{end}}[ISBN {{.ISBN}}]", "新しいフォルダ名")
-	flag.StringVar(&op.API, "API", "openbd,google,kokkai", "使用するWebAPIとアクセス順番")
-	flag.StringVar(&op.check, "check", "", "ISBN13が記入されたファイルのパス。存在すればバーコードスキャンをしない")
+	flag.StringVar(&op.API, "API", "openbd,google,kokkai", "使用するWebAPIとアクセス順番 openbd,google,kokkai,openlibrary または名前.yml")
+	flag.DurationVar(&lookup.DefaultClient.Timeout, "timeout", lookup.DefaultClient.Timeout, "WebAPIの1回のリクエストの制限時間")
+	flag.IntVar(&lookup.DefaultClient.Retries, "retries", lookup.DefaultClient.Retries, "WebAPIが5xx,429を返したときに間隔を倍にしながら再試行する回数")
+	flag.StringVar(&op.apiCache.Dir, "apiCache", lookup.DefaultCacheDir(), "WebAPIの応答を保存するフォルダ 空にするとキャッシュしない")
+	flag.DurationVar(&op.apiCache.TTL, "apiCacheTTL", 30*24*time.Hour, "キャッシュした応答の有効期間 0で無期限")
+	flag.DurationVar(&op.apiCache.MissTTL, "apiCacheMissTTL", 24*time.Hour, "見つからなかったことを覚えておく期間 0で無期限")
+	flag.BoolVar(&op.apiCache.Offline, "offline", false, "WebAPIに接続せず、期限切れも含めてキャッシュだけを使う")
+	flag.BoolVar(&op.pruneCache, "pruneCache", false, "WebAPIのキャッシュから期限切れのものを削除して終了する")
+	flag.BoolVar(&op.merge, "merge", false, "-APIのすべてに問い合わせ、欄ごとに空でない値を優先順で選んで1つにまとめる")
+	flag.StringVar(&op.mergeOrder, "mergeOrder", "", "-mergeの欄ごとの優先順 例:\"Pubdate=kokkai,google;Title=openbd\" 書かれていない欄は-APIの順")
+	flag.StringVar(&op.check, "check", "", "ISBN(10桁,13桁)が記入されたファイルのパス。存在すればバーコードスキャンをしない")
 	flag.BoolVar(&op.checknames, "checknames", false, "フォルダ名からISBN番号を読み取る")
 
 	flag.Usage = func() {
-		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] フォルダパス \n", os.Args[0])
-		fmt.Fprintf(flag.CommandLine.Output(), "　指定されたフォルダ内の画像(jpg,bmp,png)からISBNバーコードをスキャンして、WebAPIから取得した情報でフォルダ名を変更する。\n\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] フォルダパス|zip,pdfファイル \n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "　指定されたフォルダ(またはzip,cbz,pdf)内の画像(jpg,bmp,png,webp,tiff)からISBNバーコードをスキャンして、WebAPIから取得した情報でフォルダ名を変更する。\n\n")
 		flag.PrintDefaults()
 	}
 	flag.Parse()
 
-	if op.row < 1 {
-		op.row = 100
+	if err := run(&op); err != nil {
+		log.Fatalln(err)
 	}
+}
 
-	apis := make([]isbnAPI, 0, 3)
-	for _, apiname := range strings.Split(op.API, ",") {
-		switch strings.ToLower(apiname) {
-		case "openbd":
-			apis = append(apis, &openbdAPI{})
-		case "google":
-			apis = append(apis, &googleAPI{})
-		case "kokkai":
-			apis = append(apis, &kokkaiAPI{})
-		default:
-			api, err := NewWebSite(apiname + ".yml")
-			if err != nil {
-				log.Fatalf("(%s) %s\n", apiname, err)
-			} else {
-				apis = append(apis, api)
-			}
+//フラグの文字列からスキャンの設定を作る
+func (op *option) parseScanOptions() error {
+	var err error
+	if op.scan.Passes, err = scan.ParseRotations(op.rotations); err != nil {
+		return err
+	}
+	if op.scan.Strategy, err = scan.ParseStrategy(op.strategy); err != nil {
+		return err
+	}
+	if op.scan.Preprocess, err = scan.ParsePreprocess(op.preprocess); err != nil {
+		return err
+	}
+	if op.scan.ROI, err = scan.ParseROI(op.roi); err != nil {
+		return err
+	}
+	if op.scan.Metadata, err = scan.ParseMetadata(op.metadata); err != nil {
+		return err
+	}
+	if op.scan.Filter, err = scan.NewNameFilter(op.include, op.exclude); err != nil {
+		return err
+	}
+	if op.debugDir != "" {
+		if op.scan.Debug, err = scan.NewDebugDump(op.debugDir); err != nil {
+			return err
+		}
+	}
+	if op.cachePath != "" {
+		//壊れたキャッシュは空として使う 読めなければnilでキャッシュしない
+		c, err := scan.LoadCache(op.cachePath)
+		if err != nil {
+			log.Println(err)
 		}
+		op.scan.Cache = c
+	}
+	switch op.choose {
+	case scan.ChooseVotes, scan.ChooseFirst, scan.ChoosePrompt:
+	default:
+		return scan.ErrChoose
+	}
+	op.scan.Logger = log.New(os.Stderr, "", log.LstdFlags)
+	return nil
+}
+
+func run(op *option) error {
+	if err := op.parseScanOptions(); err != nil {
+		return err
+	}
+
+	var err error
+	if op.precedence, err = lookup.ParsePrecedence(op.mergeOrder); err != nil {
+		return err
+	}
+	if op.apiCache.Dir != "" {
+		lookup.DefaultClient.Cache = &op.apiCache
+	} else if op.apiCache.Offline || op.pruneCache {
+		return errors.New("-offline,-pruneCacheには-apiCacheが必要です")
+	}
+	if op.pruneCache {
+		n, err := op.apiCache.Prune()
+		log.Printf("pruneCache: %d件削除しました\n", n)
+		return err
+	}
+	names := strings.Split(op.API, ",")
+	apis := make([]lookup.API, 0, len(names))
+	for _, apiname := range names {
+		api, err := lookup.New(apiname)
+		if err != nil {
+			return fmt.Errorf("(%s) %w", apiname, err)
+		}
+		apis = append(apis, api)
 	}
 
 	if op.test {
 		log.Printf("\"%s\" をテストします。\n", op.rename)
+		code, err := isbn.LoadBookCode(op.input)
+		if err != nil && !os.IsNotExist(err) {
+			log.Printf("test(barcode): %s\n", err)
+		}
 		for _, api := range apis {
+			if s, ok := api.(lookup.BookCodeSetter); ok {
+				s.SetBookCode(code)
+			}
 			if err := api.Load(op.input); err != nil {
 				if os.IsNotExist(err) {
 					log.Printf("test(%T): データありません(%s)\n", api, err)
@@ -96,213 +194,204 @@ func main() {
 					log.Printf("test(%T): %s\n", api, err)
 				}
 			} else {
-				newname := makeFileNameFromBD(api, &op)
+				newname := makeFileNameFromBD(api, op)
 				log.Printf("test(%T): => \"%s\"\n", api, newname)
 			}
 		}
-		return
+		return nil
 	}
 
 	op.input = flag.Arg(0)
 	if op.input == "" {
-		log.Fatalln("対象フォルダを指定してください(-help)")
-		return
+		return errors.New("対象フォルダを指定してください(-help)")
 	}
 
 	stat, err := os.Stat(op.input)
 	if err != nil {
 		if os.IsNotExist(err) {
-			log.Fatalln("存在しないフォルダです")
+			return errors.New("存在しないフォルダです")
 		}
-		log.Fatalln(err)
-	} else if stat.IsDir() {
-		if op.check != "" {
-			isbn13, err := ioutil.ReadFile(op.check)
-			if err == nil {
-				tmp := regexp.MustCompile(`\D`).ReplaceAll(isbn13, nil)
-				if len(tmp) == 13 {
-					op.ISBN = string(tmp)
-					log.Printf("check: %s\n", op.check)
-				}
+		return err
+	} else if !stat.IsDir() && !scan.IsSourceFile(op.input) {
+		return scan.ErrUnknownSource
+	}
+	if op.check != "" {
+		isbn13, err := ioutil.ReadFile(op.check)
+		if err == nil {
+			if id, err := isbn.Parse(string(isbn13)); err == nil {
+				op.ISBN = id
+			} else if list := isbn.Find(string(isbn13)); len(list) > 0 {
+				op.ISBN = list[0]
+			} else {
+				log.Printf("check: %s\n", err)
 			}
-		} else if op.checknames {
-			r := regexp.MustCompile(`\d{13}|\d{9}[xX]|\d{10}`)
-			list := r.FindAllString(op.input, -1)
-			for _, txt := range list {
-				op.ISBN = txt
-				break
+			if op.ISBN != "" {
+				log.Printf("check: %s\n", op.check)
 			}
 		}
-		if op.ISBN == "" {
-			isbn := checkDir(&op)
-			if isbn != "" {
-				op.ISBN = isbn
-			}
+	} else if op.checknames {
+		name := filepath.Base(filepath.Clean(op.input))
+		if !stat.IsDir() {
+			name = strings.TrimSuffix(name, filepath.Ext(name))
+		}
+		list := isbn.Find(name)
+		if len(list) > 0 {
+			op.ISBN = list[0]
+		}
+	}
+	if op.ISBN == "" {
+		if err := op.scanInput(); err != nil {
+			return err
 		}
-	} else {
-		log.Fatalln("対象フォルダを指定してください")
 	}
 
 	if op.ISBN != "" {
 		log.Printf("ISBN: %s\n", op.ISBN)
+		if op.code != nil {
+			log.Printf("Cコード: %s\n", op.code)
+		}
 	} else {
-		log.Fatalln("バーコードが見つかりませんでした")
+		return errors.New("バーコードが見つかりませんでした")
 	}
 
 	if op.noAccess {
-		return
+		return nil
 	}
 
+	if op.merge {
+		op.mergeAPIs(apis, names, stat.IsDir())
+		return nil
+	}
 	for _, api := range apis {
-		err := api.Get(op.ISBN)
-		if err != nil {
+		if err := op.fetch(api, stat.IsDir()); err != nil {
 			log.Println(err)
 			continue
 		}
-		if op.save {
-			err := api.Save(op.input)
-			if err != nil {
-				log.Println(err)
-			}
-		}
-		newname := makeFileNameFromBD(api, &op)
-		if newname != "" {
-			olddir, oldname := filepath.Split(filepath.Clean(op.input))
-			log.Printf("rename: %s => %s\n", oldname, newname)
-			if oldname != newname {
-				newpath := filepath.Join(olddir, newname)
-				if !op.noRename {
-					if _, err := os.Stat(newpath); os.IsNotExist(err) {
-						err = os.Rename(op.input, newpath)
-						if err != nil {
-							log.Println(err)
-						}
-					} else {
-						log.Println("すでに同名のファイルが存在します")
-					}
-				}
-			}
-		}
+		op.saveRecord(api.Record(), stat.IsDir())
+		op.renameTo(makeFileNameFromBD(api, op), stat.IsDir())
 		break
 	}
+	return nil
 }
 
-//フォルダ内からファイルリストを作成
-func checkDir(op *option) string {
-	files, err := ioutil.ReadDir(op.input)
-	if err != nil {
-		log.Fatalln(err)
+//WebAPIから取得して、-saveなら元のデータを保存
+func (op *option) fetch(api lookup.API, isDir bool) error {
+	if err := api.Get(context.Background(), op.ISBN.String()); err != nil {
+		return err
 	}
-	if op.headCount > 0 {
-		txt := checkFiles(files, op.headCount, op)
-		if txt != "" {
-			return txt
-		}
+	if s, ok := api.(lookup.BookCodeSetter); ok {
+		s.SetBookCode(op.code)
 	}
-	if op.tailCount > 0 {
-		//reverse files
-		for i := len(files)/2 - 1; i >= 0; i-- {
-			opp := len(files) - 1 - i
-			files[i], files[opp] = files[opp], files[i]
+	if op.save && isDir {
+		if err := api.Save(op.input); err != nil {
+			log.Println(err)
 		}
-		return checkFiles(files, op.tailCount, op)
 	}
-	return ""
+	return nil
 }
 
-//ファイルリストから画像を探してスキャン
-func checkFiles(files []os.FileInfo, count int, op *option) string {
-	for _, file := range files {
-		if count <= 0 {
-			break
-		}
-		if file.IsDir() {
-			continue
+//-saveなら正規化した情報と2段目を保存
+func (op *option) saveRecord(r *lookup.BookRecord, isDir bool) {
+	if !op.save {
+		return
+	}
+	if !isDir {
+		log.Println("-saveはフォルダのみ対応しています")
+		return
+	}
+	if err := lookup.SaveRecord(op.input, r); err != nil {
+		log.Println(err)
+	}
+	if op.code != nil {
+		if err := op.code.Save(op.input); err != nil {
+			log.Println(err)
 		}
+	}
+}
 
-		fh, err := os.Open(filepath.Join(op.input, file.Name()))
-		if err != nil {
+//すべてのWebAPIから取得して、欄ごとに-mergeOrderの優先順で1つにまとめる
+func (op *option) mergeAPIs(apis []lookup.API, names []string, isDir bool) {
+	var sources []lookup.Source
+	for i, api := range apis {
+		if err := op.fetch(api, isDir); err != nil {
 			log.Println(err)
 			continue
 		}
-		defer fh.Close()
-		img, _, err := image.Decode(fh)
-		if err != nil {
-			continue
-		}
-		log.Printf("Scan: %s\n", file.Name())
-		isbn := getISBNfromImage(img, op)
-		if isbn != "" {
-			return isbn
-		}
-		count--
+		sources = append(sources, lookup.Source{Name: names[i], Record: api.Record()})
 	}
-	return ""
+	if len(sources) == 0 {
+		return
+	}
+	rec := lookup.Merge(sources, op.precedence)
+	rec.SetBookCode(op.code)
+	fields := make([]string, 0, len(rec.Provenance))
+	for field := range rec.Provenance {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		log.Printf("merge: %s <= %s\n", field, rec.Provenance[field])
+	}
+	op.saveRecord(rec, isDir)
+	op.renameTo(makeFileNameFromBD(rec, op), isDir)
 }
 
-//画僧をスキャンして、見つからなければ回転してもう一度スキャン
-func getISBNfromImage(img image.Image, op *option) string {
-	bmp, err := gozxing.NewBinaryBitmapFromImage(img)
-	if err != nil {
-		log.Fatalln(err)
+//フォルダ、ファイルの名前を変更 zipなどは拡張子を残す
+func (op *option) renameTo(newname string, isDir bool) {
+	if newname == "" {
+		return
 	}
-
-	if !bmp.IsCropSupported() {
-		result, err := isbnScanner.Decode(bmp, nil)
-		if err == nil {
-			return result.GetText()
-		}
-		log.Fatalln("!bmp.IsCropSupported()")
+	olddir, oldname := filepath.Split(filepath.Clean(op.input))
+	if !isDir {
+		newname += filepath.Ext(oldname)
 	}
-
-	txt := getISBNfromBmp(bmp, op)
-	if txt != "" {
-		return txt
+	log.Printf("rename: %s => %s\n", oldname, newname)
+	if oldname == newname || op.noRename {
+		return
 	}
-	if !op.noRotate {
-		if !bmp.IsRotateSupported() {
-			log.Fatalln("!bmp.IsRotateSupported()")
-		}
-		bmp90, err := bmp.RotateCounterClockwise()
-		if err != nil {
-			log.Fatalln(err)
+	newpath := filepath.Join(olddir, newname)
+	if _, err := os.Stat(newpath); os.IsNotExist(err) {
+		if err := os.Rename(op.input, newpath); err != nil {
+			log.Println(err)
 		}
-		txt = getISBNfromBmp(bmp90, op)
+	} else {
+		log.Println("すでに同名のファイルが存在します")
 	}
-	return txt
 }
 
-//画像をスキャン バーコードが2つあるので、画像を細かく区切って上から検索する必要がある
-func getISBNfromBmp(bmp *gozxing.BinaryBitmap, op *option) string {
-	height := bmp.GetHeight()
-	width := bmp.GetWidth()
-	cropHeight := height / op.row
-	if cropHeight < 1 {
-		cropHeight = 1
+//画像をスキャンしてISBNを決める 確度の低いISBNは使わない
+func (op *option) scanInput() error {
+	results, err := scan.ScanDir(context.Background(), op.input, op.scan)
+	if err := op.scan.Debug.Save(); err != nil {
+		log.Println(err)
 	}
-
-	for top := 0; top+cropHeight <= height; top += cropHeight {
-		//分割
-		newBmp, err := bmp.Crop(0, top, width, cropHeight)
-		if err != nil {
-			log.Fatalf("!bmp.Crop(%d,%d,%d,%d)\n", 0, top, width, cropHeight)
-		}
-		//バーコードを探す
-		result, err := isbnScanner.DecodeWithoutHints(newBmp)
-		if err == nil {
-			txt := result.GetText()
-			//ISBNはいずれかで始まる
-			if strings.HasPrefix(txt, "978") || strings.HasPrefix(txt, "979") {
-				return txt
-			}
+	if err := op.scan.Cache.Save(); err != nil {
+		log.Println(err)
+	}
+	if err != nil {
+		return err
+	}
+	if len(results) > 1 {
+		log.Printf("複数のISBNが見つかりました(-choose %s)\n", op.choose)
+		for _, v := range results {
+			log.Printf("  %s votes=%d %s\n", v.ISBN, v.Votes, strings.Join(v.Files, ","))
 		}
 	}
-
-	return ""
+	res, err := scan.Choose(results, op.choose, os.Stdin, os.Stderr)
+	if err != nil {
+		return err
+	}
+	if res.LowConfidence {
+		log.Printf("確度が低いため使いません: ISBN %s (%d/%d)\n", res.ISBN, res.Votes, op.scan.Confirm)
+	} else if res.ISBN != "" {
+		op.ISBN = res.ISBN
+		op.code = res.Code
+	}
+	return nil
 }
 
 //WebAPIのデータからファイル名を作成
-func makeFileNameFromBD(data isbnAPI, op *option) string {
+func makeFileNameFromBD(data interface{}, op *option) string {
 
 	tmpl, err := template.New("name").Funcs(template.FuncMap{"hasField": hasField}).Parse(op.rename)
 	if err != nil {
@@ -354,6 +443,10 @@ func replaceFileName(old string) string {
 //https://stackoverflow.com/questions/34703133/field-detection-in-go-html-template
 func hasField(v interface{}, name string) bool {
 	rv := reflect.ValueOf(v)
+	//{{.CCode}}などはメソッド
+	if rv.IsValid() && rv.MethodByName(name).IsValid() {
+		return true
+	}
 	if rv.Kind() == reflect.Ptr {
 		rv = rv.Elem()
 	}
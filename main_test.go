@@ -1,29 +1,34 @@
 package main
 
 import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io/ioutil"
 	"log"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/oned"
+
+	"github.com/y9o/isbn2title/isbn"
+	"github.com/y9o/isbn2title/lookup"
+	"github.com/y9o/isbn2title/scan"
 )
 
 func TestTemplate(t *testing.T) {
 
-	apis := make([]isbnAPI, 0, 4)
+	apis := make([]lookup.API, 0, 4)
 	for _, apiname := range strings.Split("google,openbd,kokkai,calilWEB", ",") {
-		switch strings.ToLower(apiname) {
-		case "openbd":
-			apis = append(apis, &openbdAPI{})
-		case "google":
-			apis = append(apis, &googleAPI{})
-		case "kokkai":
-			apis = append(apis, &kokkaiAPI{})
-		default:
-			api, err := NewWebSite(apiname + ".yml")
-			if err != nil {
-				t.Errorf("err(%s)%s\n", apiname, err)
-			} else {
-				apis = append(apis, api)
-			}
+		api, err := lookup.New(apiname)
+		if err != nil {
+			t.Errorf("err(%s)%s\n", apiname, err)
+		} else {
+			apis = append(apis, api)
 		}
 	}
 	for _, api := range apis {
@@ -32,3 +37,42 @@ func TestTemplate(t *testing.T) {
 		log.Printf("test(%T): => \"%s\"\n", api, newname)
 	}
 }
+
+//-head 0 -tail 0は画像をスキャンしない
+func TestNoImageScan(t *testing.T) {
+	dir, err := ioutil.TempDir("", "isbn2title")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	img := image.NewGray(image.Rect(0, 0, 800, 1000))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	bar, err := oned.NewEAN13Writer().Encode("9784088725093", gozxing.BarcodeFormat_EAN_13, 300, 90, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	draw.Draw(img, bar.Bounds().Add(image.Pt(440, 60)), bar, image.Point{}, draw.Src)
+	fh, err := os.Create(filepath.Join(dir, "1.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = png.Encode(fh, img)
+	fh.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		head int
+		want isbn.ISBN
+	}{{0, ""}, {1, "9784088725093"}} {
+		op := &option{input: dir, choose: scan.ChooseVotes}
+		op.scan = scan.Options{Row: 100, Head: tt.head, Jobs: 1, NoRotate: true}
+		if err := op.scanInput(); err != nil {
+			t.Fatal(err)
+		}
+		if op.ISBN != tt.want {
+			t.Errorf("head=%d: ISBN = %q", tt.head, op.ISBN)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package scan
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+//スキャン結果のキャッシュ 画像の内容とスキャン設定が同じなら前回の結果を使う
+//バーコードがなかった画像も空の結果として残す
+type Cache struct {
+	path    string
+	mu      sync.Mutex
+	entries map[string]Result
+	dirty   bool
+}
+
+//Openで元の画像データを読めない読み込み元 PDFの圧縮された画像など
+type rawSource interface {
+	Raw(name string) ([]byte, error)
+}
+
+//キャッシュファイルの初期値
+func DefaultCachePath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "isbn2title", "scan_cache.json")
+}
+
+//キャッシュファイルを読む ファイルがなければ空のキャッシュ
+//壊れていれば空のキャッシュとエラーを返す 保存すると作り直す
+func LoadCache(path string) (*Cache, error) {
+	c := &Cache{path: path, entries: map[string]Result{}}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &c.entries); err != nil {
+		c.entries = map[string]Result{}
+		return c, fmt.Errorf("%s: キャッシュが壊れているため作り直します: %w", path, err)
+	}
+	return c, nil
+}
+
+//変更があれば保存
+func (c *Cache) Save() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.dirty {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(c.entries)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(c.path, data); err != nil {
+		return err
+	}
+	c.dirty = false
+	return nil
+}
+
+//同じフォルダの一時ファイルに書いてから置き換える 途中で止まっても元のファイルは壊れない
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+//画像の内容とスキャン設定からキーを作る 読めなければ空
+func (c *Cache) key(src imageSource, name string, op *Options) string {
+	if c == nil {
+		return ""
+	}
+	h := sha256.New()
+	base, page := splitPage(name)
+	if fh, err := src.Open(base); err == nil {
+		_, err = io.Copy(h, fh)
+		fh.Close()
+		if err != nil {
+			return ""
+		}
+	} else if r, ok := src.(rawSource); ok {
+		data, err := r.Raw(base)
+		if err != nil {
+			return ""
+		}
+		h.Write(data)
+	} else {
+		return ""
+	}
+	fmt.Fprintf(h, "\x00%d\x00%s", page, op.scanSettings())
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *Cache) get(key string) (Result, bool) {
+	if c == nil || key == "" {
+		return Result{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	res, ok := c.entries[key]
+	return res, ok
+}
+
+func (c *Cache) put(key string, res Result) {
+	if c == nil || key == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = res
+	c.dirty = true
+}
+
+//結果が変わるスキャン設定
+func (op *Options) scanSettings() string {
+	return fmt.Sprintf("row=%d strategy=%s rotations=%v preprocess=%s roi=%v confirm=%d maxPixels=%d",
+		op.rowCount(), op.Strategy, op.scanPasses(), op.Preprocess, op.ROI, op.confirmCount(), op.MaxPixels)
+}
@@ -0,0 +1,104 @@
+package scan
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestScanCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "isbn2title")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	book := filepath.Join(dir, "book")
+	if err := os.Mkdir(book, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestImage(t, filepath.Join(book, "001.png"), testCover(t))
+	writeTestImage(t, filepath.Join(book, "002.png"), testCover(t, "9784088725093"))
+	src, err := newDirSource(book)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "cache", "scan_cache.json")
+	c, err := LoadCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	op := &Options{Row: 100, Head: 2, Jobs: 1, NoRotate: true, Cache: c}
+	if res := testCheckDir(t, src, op); res.ISBN != "9784088725093" {
+		t.Fatalf("ISBN = %q", res.ISBN)
+	}
+	//バーコードのない画像も残る
+	if len(c.entries) != 2 {
+		t.Fatalf("entries = %v", c.entries)
+	}
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	//キャッシュの結果が使われることを確かめるため書き換える
+	c, err = LoadCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	op.Cache = c
+	key := c.key(src, "002.png", op)
+	if _, ok := c.get(key); !ok {
+		t.Fatal("002.png not cached")
+	}
+	c.put(key, Result{ISBN: "9780804429573", Votes: 1})
+	if res := testCheckDir(t, src, op); res.ISBN != "9780804429573" {
+		t.Errorf("cached ISBN = %q", res.ISBN)
+	}
+	op.Rescan = true
+	if res := testCheckDir(t, src, op); res.ISBN != "9784088725093" {
+		t.Errorf("rescan ISBN = %q", res.ISBN)
+	}
+	//設定が変われば別のキー
+	op.Confirm = 3
+	if c.key(src, "002.png", op) == key {
+		t.Error("same key for different settings")
+	}
+}
+
+//壊れたキャッシュファイルは空のキャッシュとして読み、保存で作り直す
+func TestCorruptCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "isbn2title")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "scan_cache.json")
+	if err := ioutil.WriteFile(path, []byte(`{"abc": {"ISBN": "97840`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := LoadCache(path)
+	if err == nil {
+		t.Error("no error for corrupt cache")
+	}
+	if c == nil || len(c.entries) != 0 {
+		t.Fatalf("LoadCache = %v", c)
+	}
+	c.put("abc", Result{ISBN: "9784088725093"})
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+	c, err = LoadCache(path)
+	if err != nil || c.entries["abc"].ISBN != "9784088725093" {
+		t.Errorf("LoadCache = %v, %v", c.entries, err)
+	}
+	//書き込み用の一時ファイルは残らない
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("files = %d", len(files))
+	}
+}
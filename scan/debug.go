@@ -0,0 +1,246 @@
+package scan
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/makiuchi-d/gozxing"
+
+	"github.com/y9o/isbn2title/isbn"
+)
+
+//-debugで保存するログのファイル名
+const debugLogName = "scan_debug.json"
+
+//読めなかった範囲でも、中央の行の白黒の切り替わりがこれ以上あればバーコードに近いとみなす
+//EAN-13は30本のバーで60回切り替わる
+const debugAlmostTransitions = 50
+
+//-debug 読み込んだ画像、範囲、二値化した帯とデコードの記録を保存する
+type DebugDump struct {
+	dir      string
+	mu       sync.Mutex
+	attempts []debugAttempt
+	err      error //画像を保存できなかった最初のエラー Saveで返す
+}
+
+//デコード1回分の記録
+type debugAttempt struct {
+	File   string `json:"file"`
+	Stage  string `json:"stage"`  //small,full,preprocess -roiの範囲はroi_small,roi_fullなど
+	Rotate string `json:"rotate"` //scanPass
+	Rect   [4]int `json:"rect"`   //回転後の座標 x0,y0,x1,y1
+	Result string `json:"result"` //isbn,bookcode,rejected,almost,none
+	Text   string `json:"text,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type debugKey struct{}
+
+//スキャン中の画像とその段階
+type debugScan struct {
+	dump  *DebugDump
+	file  string
+	stage string
+}
+
+//1つの向きでスキャンした範囲
+type debugPass struct {
+	debugScan
+	pass  Pass
+	lum   gozxing.LuminanceSource
+	tried []image.Rectangle
+	found []image.Rectangle
+	near  []image.Rectangle
+}
+
+func NewDebugDump(dir string) (*DebugDump, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &DebugDump{dir: dir}, nil
+}
+
+//画像ごとの記録を始める -debugがなければctxのまま
+func (d *DebugDump) scan(ctx context.Context, file string) context.Context {
+	if d == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, debugKey{}, &debugScan{dump: d, file: file})
+}
+
+//スキャンの段階を後ろに加える
+func debugStage(ctx context.Context, stage string) context.Context {
+	s, ok := ctx.Value(debugKey{}).(*debugScan)
+	if !ok {
+		return ctx
+	}
+	c := *s
+	if c.stage != "" {
+		stage = c.stage + "_" + stage
+	}
+	c.stage = stage
+	return context.WithValue(ctx, debugKey{}, &c)
+}
+
+//向きごとの記録を始める
+func debugBegin(ctx context.Context, pass Pass, lum gozxing.LuminanceSource) (context.Context, *debugPass) {
+	s, ok := ctx.Value(debugKey{}).(*debugScan)
+	if !ok {
+		return ctx, nil
+	}
+	p := &debugPass{debugScan: *s, pass: pass, lum: lum}
+	return context.WithValue(ctx, debugKey{}, p), p
+}
+
+func debugFrom(ctx context.Context) *debugPass {
+	p, _ := ctx.Value(debugKey{}).(*debugPass)
+	return p
+}
+
+//デコード結果を記録 読めた範囲とバーコードに近い範囲は二値化した帯を保存する
+func (p *debugPass) attempt(r image.Rectangle, bmp *gozxing.BinaryBitmap, text string, err error) {
+	if p == nil {
+		return
+	}
+	result := "rejected"
+	if err != nil {
+		result = "none"
+		if blackTransitions(bmp) >= debugAlmostTransitions {
+			result = "almost"
+		}
+	} else if _, e := isbn.Parse(text); e == nil {
+		result = "isbn"
+	} else if _, e := isbn.ParseBookCode(text); e == nil {
+		result = "bookcode"
+	}
+	a := debugAttempt{
+		File:   p.file,
+		Stage:  p.stage,
+		Rotate: p.pass.String(),
+		Rect:   [4]int{r.Min.X, r.Min.Y, r.Max.X, r.Max.Y},
+		Result: result,
+		Text:   text,
+	}
+	if err != nil {
+		a.Error = err.Error()
+	}
+	p.dump.mu.Lock()
+	p.dump.attempts = append(p.dump.attempts, a)
+	p.dump.mu.Unlock()
+
+	p.tried = append(p.tried, r)
+	switch result {
+	case "none":
+		return
+	case "almost":
+		p.near = append(p.near, r)
+	default:
+		p.found = append(p.found, r)
+	}
+	matrix, err := bmp.GetBlackMatrix()
+	if err != nil {
+		return
+	}
+	name := fmt.Sprintf("%s_%d_%d_%s.png", p.baseName(), r.Min.X, r.Min.Y, result)
+	p.dump.writePNG(name, matrix)
+}
+
+//試した範囲を画像に描いて保存 青:試した範囲 赤:読めた 橙:近い
+func (p *debugPass) finish() {
+	if p == nil {
+		return
+	}
+	w, h := p.lum.GetWidth(), p.lum.GetHeight()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	gray := p.lum.GetMatrix()
+	for i, v := range gray {
+		img.Pix[i*4], img.Pix[i*4+1], img.Pix[i*4+2], img.Pix[i*4+3] = v, v, v, 0xff
+	}
+	for _, r := range p.tried {
+		drawRect(img, r, color.RGBA{0x80, 0x80, 0xff, 0xff}, 1)
+	}
+	for _, r := range p.near {
+		drawRect(img, r, color.RGBA{0xff, 0xa0, 0x00, 0xff}, 2)
+	}
+	for _, r := range p.found {
+		drawRect(img, r, color.RGBA{0xff, 0x00, 0x00, 0xff}, 2)
+	}
+	p.dump.writePNG(p.baseName()+".png", img)
+}
+
+//ファイル名_段階_向き
+func (p *debugPass) baseName() string {
+	name := strings.NewReplacer("/", "_", "\\", "_", "#", "_", ":", "_").Replace(p.file)
+	return fmt.Sprintf("%s_%s_%s", name, p.stage, p.pass)
+}
+
+func (d *DebugDump) writePNG(name string, img image.Image) {
+	fh, err := os.Create(filepath.Join(d.dir, name))
+	if err == nil {
+		err = png.Encode(fh, img)
+		fh.Close()
+	}
+	if err != nil {
+		d.mu.Lock()
+		if d.err == nil {
+			d.err = err
+		}
+		d.mu.Unlock()
+	}
+}
+
+//デコードの記録をJSONで保存
+func (d *DebugDump) Save() error {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	data, err := json.MarshalIndent(d.attempts, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(d.dir, debugLogName), data, 0644); err != nil {
+		return err
+	}
+	return d.err
+}
+
+//中央の行で白黒が切り替わる回数
+func blackTransitions(bmp *gozxing.BinaryBitmap) int {
+	row, err := bmp.GetBlackRow(bmp.GetHeight()/2, nil)
+	if err != nil {
+		return 0
+	}
+	n := 0
+	for i := 1; i < row.GetSize(); i++ {
+		if row.Get(i) != row.Get(i-1) {
+			n++
+		}
+	}
+	return n
+}
+
+//矩形の枠を描く
+func drawRect(img draw.Image, r image.Rectangle, c color.Color, width int) {
+	u := image.NewUniform(c)
+	for _, side := range []image.Rectangle{
+		image.Rect(r.Min.X, r.Min.Y, r.Max.X, r.Min.Y+width),
+		image.Rect(r.Min.X, r.Max.Y-width, r.Max.X, r.Max.Y),
+		image.Rect(r.Min.X, r.Min.Y, r.Min.X+width, r.Max.Y),
+		image.Rect(r.Max.X-width, r.Min.Y, r.Max.X, r.Max.Y),
+	} {
+		draw.Draw(img, side.Intersect(img.Bounds()), u, image.Point{}, draw.Src)
+	}
+}
@@ -0,0 +1,61 @@
+package scan
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDebugDump(t *testing.T) {
+	dir, err := ioutil.TempDir("", "isbn2title")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeTestImage(t, filepath.Join(dir, "001.png"), testCover(t, "9784088725093", "1920979007000"))
+	src, err := newDirSource(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "debug")
+	d, err := NewDebugDump(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	op := &Options{Row: 100, Head: 1, Jobs: 1, NoRotate: true, Debug: d}
+	if res := testCheckDir(t, src, op); res.ISBN != "9784088725093" {
+		t.Fatalf("ISBN = %q", res.ISBN)
+	}
+	if err := d.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(out, debugLogName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var attempts []debugAttempt
+	if err := json.Unmarshal(data, &attempts); err != nil {
+		t.Fatal(err)
+	}
+	count := map[string]int{}
+	for _, a := range attempts {
+		if a.File != "001.png" || a.Stage != "full" || a.Rotate != "0" {
+			t.Fatalf("attempt = %+v", a)
+		}
+		count[a.Result]++
+	}
+	if count["isbn"] == 0 || count["bookcode"] == 0 || count["none"] == 0 {
+		t.Errorf("results = %v", count)
+	}
+	if _, err := os.Stat(filepath.Join(out, "001.png_full_0.png")); err != nil {
+		t.Error(err)
+	}
+	strips, _ := filepath.Glob(filepath.Join(out, "001.png_full_0_*_isbn.png"))
+	if len(strips) == 0 {
+		t.Error("no isbn strip")
+	}
+}
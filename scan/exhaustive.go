@@ -0,0 +1,249 @@
+package scan
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/oned"
+
+	"github.com/y9o/isbn2title/isbn"
+)
+
+//Chooseの規則
+const (
+	ChooseVotes  = "votes"  //読めた範囲の数が最も多いもの
+	ChooseFirst  = "first"  //最初の画像のもの
+	ChoosePrompt = "prompt" //番号を入力して選ぶ
+)
+
+var ErrChoose = errors.New("-chooseはvotes,first,promptのいずれかを指定してください")
+
+//Exhaustiveで見つかったバーコード 同じ画像、同じ向きで同じ値を読めた範囲をまとめる
+type barcodeHit struct {
+	File  string
+	Pass  Pass
+	Rect  image.Rectangle //読めた範囲を合わせた矩形 回転後の座標
+	Text  string
+	ISBN  isbn.ISBN //ISBNでなければ空
+	Votes int       //読めた範囲の数
+}
+
+func (h barcodeHit) String() string {
+	return fmt.Sprintf("%s %s rotate=%s rect=%v votes=%d", h.Text, h.File, h.Pass, h.Rect, h.Votes)
+}
+
+//スキャンする画像をすべて最後までスキャンして、見つかったバーコードを画像の順に並べる
+func checkDirAll(ctx context.Context, src imageSource, op *Options) ([]barcodeHit, error) {
+	names := scanList(src, op)
+	jobs := op.Jobs
+	if jobs < 1 {
+		jobs = 1
+	}
+	found := make([][]barcodeHit, len(names))
+	errs := make([]error, len(names))
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				found[i], errs[i] = scanFileAll(ctx, src, names[i], op)
+			}
+		}()
+	}
+	for i := range names {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var hits []barcodeHit
+	for i, list := range found {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		hits = append(hits, list...)
+	}
+	return hits, nil
+}
+
+//画像ファイルを読み込んで、すべての向きでスキャン
+func scanFileAll(ctx context.Context, src imageSource, name string, op *Options) ([]barcodeHit, error) {
+	img, err := decodeScanImage(src, name, op)
+	if err != nil {
+		if !errors.Is(err, image.ErrFormat) {
+			op.logf("%s: %s\n", name, err)
+		}
+		return nil, nil
+	}
+	op.logf("Scan: %s\n", name)
+	hits, err := collectFromImage(ctx, img, op)
+	for i := range hits {
+		hits[i].File = name
+	}
+	return hits, err
+}
+
+//画像処理の前後、すべての向きで読めたバーコード
+func collectFromImage(ctx context.Context, img image.Image, op *Options) ([]barcodeHit, error) {
+	var hits []barcodeHit
+	index := map[string]int{}
+	scan := func(img image.Image, binarizer func(gozxing.LuminanceSource) gozxing.Binarizer) error {
+		src := gozxing.NewLuminanceSourceFromImage(img)
+		for _, pass := range op.scanPasses() {
+			bmp, _, err := passBitmap(src, pass, binarizer)
+			if err != nil {
+				return err
+			}
+			list, err := collectFromBmp(ctx, bmp, op)
+			if err != nil {
+				return err
+			}
+			for _, h := range list {
+				h.Pass = pass
+				key := pass.String() + " " + h.Text
+				if i, ok := index[key]; ok {
+					hits[i].Votes += h.Votes
+					hits[i].Rect = hits[i].Rect.Union(h.Rect)
+					continue
+				}
+				index[key] = len(hits)
+				hits = append(hits, h)
+			}
+		}
+		return nil
+	}
+	if err := scan(img, gozxing.NewHybridBinarizer); err != nil {
+		return nil, err
+	}
+	if op.Preprocess != nil {
+		if err := scan(op.Preprocess.apply(img), op.Preprocess.binarizer()); err != nil {
+			return nil, err
+		}
+	}
+	return hits, nil
+}
+
+//すべての範囲をスキャンして、読めたEAN-13を値ごとにまとめる
+func collectFromBmp(ctx context.Context, bmp *gozxing.BinaryBitmap, op *Options) ([]barcodeHit, error) {
+	rects := op.cropRects(bmp.GetWidth(), bmp.GetHeight())
+	scanner := oned.NewEAN13Reader()
+	var hits []barcodeHit
+	index := map[string]int{}
+	for _, r := range rects {
+		if ctx.Err() != nil {
+			break
+		}
+		newBmp, err := bmp.Crop(r.Min.X, r.Min.Y, r.Dx(), r.Dy())
+		if err != nil {
+			return nil, fmt.Errorf("bmp.Crop(%d,%d,%d,%d): %w", r.Min.X, r.Min.Y, r.Dx(), r.Dy(), err)
+		}
+		result, err := scanner.DecodeWithoutHints(newBmp)
+		if err != nil {
+			continue
+		}
+		txt := result.GetText()
+		if i, ok := index[txt]; ok {
+			hits[i].Votes++
+			hits[i].Rect = hits[i].Rect.Union(r)
+			continue
+		}
+		h := barcodeHit{Rect: r, Text: txt, Votes: 1}
+		if id, err := isbn.Parse(txt); err == nil {
+			h.ISBN = id
+		}
+		index[txt] = len(hits)
+		hits = append(hits, h)
+	}
+	return hits, nil
+}
+
+//見つかったバーコードを表示して、ISBNごとに読めた範囲の数を合計する 最初に見つかった順
+//2段目は同じ画像のものを優先
+func resultsFromHits(hits []barcodeHit, op *Options) []Result {
+	var results []Result
+	index := map[isbn.ISBN]int{}
+	for _, h := range hits {
+		op.logf("Found: %s\n", h)
+		if h.ISBN == "" {
+			continue
+		}
+		i, ok := index[h.ISBN]
+		if !ok {
+			i = len(results)
+			index[h.ISBN] = i
+			results = append(results, Result{ISBN: h.ISBN, File: h.File})
+		}
+		res := &results[i]
+		res.Votes += h.Votes
+		if len(res.Files) == 0 || res.Files[len(res.Files)-1] != h.File {
+			res.Files = append(res.Files, h.File)
+		}
+	}
+	for i := range results {
+		res := &results[i]
+		res.LowConfidence = res.Votes < op.confirmCount()
+		for _, h := range hits {
+			code, err := isbn.ParseBookCode(h.Text)
+			if err != nil {
+				continue
+			}
+			if res.Code == nil || h.File == res.File {
+				res.Code = code
+			}
+			if h.File == res.File {
+				break
+			}
+		}
+	}
+	return results
+}
+
+//Exhaustiveで見つかった複数のISBNから規則で1つ選ぶ ChoosePromptはinから番号を読む
+func Choose(results []Result, rule string, in io.Reader, out io.Writer) (Result, error) {
+	switch {
+	case len(results) == 0:
+		return Result{}, nil
+	case len(results) == 1:
+		return results[0], nil
+	}
+	switch rule {
+	case ChooseFirst:
+		return results[0], nil
+	case ChoosePrompt:
+		for i, v := range results {
+			fmt.Fprintf(out, "%d) %s votes=%d %s\n", i+1, v.ISBN, v.Votes, strings.Join(v.Files, ","))
+		}
+		fmt.Fprint(out, "番号を選んでください: ")
+		line, err := bufio.NewReader(in).ReadString('\n')
+		if err != nil && line == "" {
+			return Result{}, err
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(line))
+		if err != nil || n < 1 || n > len(results) {
+			return Result{}, fmt.Errorf("番号が正しくありません: %s", strings.TrimSpace(line))
+		}
+		return results[n-1], nil
+	case ChooseVotes, "":
+		best := results[0]
+		for _, v := range results[1:] {
+			if v.Votes > best.Votes {
+				best = v
+			}
+		}
+		return best, nil
+	}
+	return Result{}, fmt.Errorf("%w: %s", ErrChoose, rule)
+}
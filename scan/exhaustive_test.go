@@ -0,0 +1,80 @@
+package scan
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/y9o/isbn2title/isbn"
+)
+
+func TestExhaustive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "isbn2title")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	//外箱と中身で違うISBN
+	writeTestImage(t, filepath.Join(dir, "001.png"), testCover(t, "9784088725093", "1920979007000"))
+	writeTestImage(t, filepath.Join(dir, "002.png"), testCover(t))
+	writeTestImage(t, filepath.Join(dir, "003.png"), testCover(t, "9780804429573"))
+	writeTestImage(t, filepath.Join(dir, "004.png"), testCover(t, "9780804429573"))
+	src, err := newDirSource(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	op := &Options{Row: 100, Head: 4, Jobs: 2, NoRotate: true}
+	hits, err := checkDirAll(context.Background(), src, op)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 4 || hits[0].File != "001.png" || hits[0].Votes < 1 || hits[0].Rect.Empty() {
+		t.Fatalf("hits = %v", hits)
+	}
+	if hits[1].ISBN != "" || hits[1].Text != "1920979007000" {
+		t.Errorf("hits[1] = %v", hits[1])
+	}
+
+	results := resultsFromHits(hits, op)
+	if len(results) != 2 || results[1].Votes != hits[2].Votes*2 || strings.Join(results[1].Files, ",") != "003.png,004.png" {
+		t.Fatalf("results = %v", results)
+	}
+	//2段目は同じ画像のもの
+	if results[0].Code == nil || results[0].Code.Price != 700 || results[1].Code == nil {
+		t.Errorf("Code = %v, %v", results[0].Code, results[1].Code)
+	}
+	for _, v := range []struct {
+		rule  string
+		input string
+		want  isbn.ISBN
+	}{
+		{ChooseVotes, "", "9780804429573"},
+		{ChooseFirst, "", "9784088725093"},
+		{ChoosePrompt, "1\n", "9784088725093"},
+		{ChoosePrompt, "2\n", "9780804429573"},
+	} {
+		var out bytes.Buffer
+		got, err := Choose(results, v.rule, strings.NewReader(v.input), &out)
+		if err != nil || got.ISBN != v.want {
+			t.Errorf("%s %q: %s, %v", v.rule, v.input, got.ISBN, err)
+		}
+	}
+	if _, err := Choose(results, ChoosePrompt, strings.NewReader("3\n"), ioutil.Discard); err == nil {
+		t.Error("prompt 3: no error")
+	}
+	if _, err := Choose(results, "most", nil, nil); !errors.Is(err, ErrChoose) {
+		t.Errorf("unknown rule: %v", err)
+	}
+
+	//公開APIからも同じ結果
+	list, err := ScanDir(context.Background(), dir, Options{Row: 100, Head: 4, Jobs: 2, NoRotate: true, Exhaustive: true})
+	if err != nil || len(list) != 2 || list[0].File != "001.png" {
+		t.Errorf("ScanDir = %v, %v", list, err)
+	}
+}
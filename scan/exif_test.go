@@ -0,0 +1,95 @@
+package scan
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+//SOIの直後にOrientationだけのEXIFを差し込む
+func testJPEGWithOrientation(t *testing.T, img image.Image, orientation int) []byte {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	var tiff bytes.Buffer
+	tiff.WriteString("MM\x00\x2a")
+	binary.Write(&tiff, binary.BigEndian, uint32(8))
+	binary.Write(&tiff, binary.BigEndian, uint16(1))
+	binary.Write(&tiff, binary.BigEndian, []uint16{0x0112, 3})
+	binary.Write(&tiff, binary.BigEndian, uint32(1))
+	binary.Write(&tiff, binary.BigEndian, []uint16{uint16(orientation), 0})
+	binary.Write(&tiff, binary.BigEndian, uint32(0))
+	app1 := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+
+	data := buf.Bytes()
+	var out bytes.Buffer
+	out.Write(data[:2])
+	out.Write([]byte{0xFF, 0xE1})
+	binary.Write(&out, binary.BigEndian, uint16(len(app1)+2))
+	out.Write(app1)
+	out.Write(data[2:])
+	return out.Bytes()
+}
+
+func TestApplyOrientation(t *testing.T) {
+	src := image.NewGray(image.Rect(0, 0, 3, 2))
+	copy(src.Pix, []byte{1, 2, 3, 4, 5, 6})
+	for _, v := range []struct {
+		orientation int
+		pix         []byte
+	}{
+		{1, []byte{1, 2, 3, 4, 5, 6}},
+		{2, []byte{3, 2, 1, 6, 5, 4}},
+		{3, []byte{6, 5, 4, 3, 2, 1}},
+		{4, []byte{4, 5, 6, 1, 2, 3}},
+		{5, []byte{1, 4, 2, 5, 3, 6}},
+		{6, []byte{4, 1, 5, 2, 6, 3}},
+		{7, []byte{6, 3, 5, 2, 4, 1}},
+		{8, []byte{3, 6, 2, 5, 1, 4}},
+	} {
+		got := toGray(applyOrientation(src, v.orientation))
+		if !bytes.Equal(got.Pix, v.pix) {
+			t.Errorf("orientation %d: %v", v.orientation, got.Pix)
+		}
+	}
+}
+
+func TestExifOrientation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "isbn2title")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	//左に90度寝かせて保存し、Orientation 6(右に90度回して表示)を付ける
+	cover := testCover(t, "9784088725093")
+	w, h := cover.Rect.Dx(), cover.Rect.Dy()
+	stored := image.NewGray(image.Rect(0, 0, h, w))
+	for y := 0; y < w; y++ {
+		for x := 0; x < h; x++ {
+			stored.Pix[y*stored.Stride+x] = cover.Pix[x*cover.Stride+w-1-y]
+		}
+	}
+	data := testJPEGWithOrientation(t, stored, 6)
+	if v := exifOrientation(data); v != 6 {
+		t.Fatalf("exifOrientation = %d", v)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "001.jpg"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	src, err := newDirSource(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//回転パスなしでも読めること
+	op := &Options{Row: 100, Head: 1, Jobs: 1, NoRotate: true}
+	if res := testCheckDir(t, src, op); res.ISBN != "9784088725093" {
+		t.Errorf("ISBN = %q", res.ISBN)
+	}
+}
@@ -0,0 +1,94 @@
+package scan
+
+import (
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/y9o/isbn2title/isbn"
+)
+
+//Harvestで読むテキストファイルの拡張子
+var harvestExts = map[string]bool{
+	".txt":  true,
+	".url":  true,
+	".html": true,
+	".htm":  true,
+	".md":   true,
+}
+
+//これより大きなファイルは読まない
+const harvestMaxSize = 1 << 20
+
+//テキストファイルに書かれたISBNの候補
+type harvestHit struct {
+	ISBN  isbn.ISBN
+	Count int      //現れた回数
+	Files []string //現れたファイル
+}
+
+//フォルダ、ZIP内の小さなテキストファイルからISBNを集めて、現れた回数の多い順に並べる
+//同じ回数なら先に現れたもの
+func harvestText(src imageSource, op *Options) []harvestHit {
+	var hits []harvestHit
+	index := map[isbn.ISBN]int{}
+	for _, name := range src.Names() {
+		if !harvestExts[strings.ToLower(path.Ext(name))] {
+			continue
+		}
+		text, err := readSmallText(src, name)
+		if err != nil {
+			op.logf("%s: %s\n", name, err)
+			continue
+		}
+		for _, id := range isbn.FindAll(text) {
+			i, ok := index[id]
+			if !ok {
+				i = len(hits)
+				index[id] = i
+				hits = append(hits, harvestHit{ISBN: id})
+			}
+			h := &hits[i]
+			h.Count++
+			if len(h.Files) == 0 || h.Files[len(h.Files)-1] != name {
+				h.Files = append(h.Files, name)
+			}
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool {
+		return hits[i].Count > hits[j].Count
+	})
+	return hits
+}
+
+//harvestMaxSizeまで読む 大きなファイルは空
+func readSmallText(src imageSource, name string) (string, error) {
+	fh, err := src.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer fh.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(fh, harvestMaxSize+1))
+	if err != nil || len(data) > harvestMaxSize {
+		return "", err
+	}
+	return string(data), nil
+}
+
+//最も多く現れたISBN 見つからなければ空
+func probeHarvest(src imageSource, op *Options) Result {
+	if !op.Harvest {
+		return Result{}
+	}
+	hits := harvestText(src, op)
+	for _, h := range hits {
+		op.logf("Harvest: %s count=%d %s\n", h.ISBN, h.Count, strings.Join(h.Files, ","))
+	}
+	if len(hits) == 0 {
+		return Result{}
+	}
+	best := hits[0]
+	return Result{ISBN: best.ISBN, Votes: best.Count, File: best.Files[0], Files: best.Files}
+}
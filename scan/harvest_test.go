@@ -0,0 +1,48 @@
+package scan
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHarvest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "isbn2title")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"amazon.url": "[InternetShortcut]\r\nURL=https://www.amazon.co.jp/dp/080442957X/ref=sr_1_1\r\n",
+		"memo.md":    "ISBN978-4-08-872509-3 を参照 ISBN 978-4-08-872509-4(誤)",
+		"page.html":  `<a href="https://www.shueisha.co.jp/books/items/contents.html?isbn=978-4-08-872509-3">9784088725093</a>`,
+		"cover.jpg":  "9780804429573 9780804429573 9780804429573",
+		"big.txt":    strings.Repeat("9780804429573 ", harvestMaxSize/10),
+	}
+	for name, body := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	src, err := newDirSource(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hits := harvestText(src, &Options{})
+	if len(hits) != 2 || hits[0].ISBN != "9784088725093" || hits[0].Count != 3 || strings.Join(hits[0].Files, ",") != "memo.md,page.html" ||
+		hits[1].ISBN != "9780804429573" || hits[1].Count != 1 {
+		t.Errorf("harvestText = %+v", hits)
+	}
+
+	list, err := ScanDir(context.Background(), dir, Options{Harvest: true, Confirm: 5})
+	if err != nil || len(list) != 1 || list[0].ISBN != "9784088725093" || list[0].File != "memo.md" || !list[0].confirmed() {
+		t.Errorf("ScanDir = %+v, %v", list, err)
+	}
+	if list, err := ScanDir(context.Background(), dir, Options{}); err != nil || len(list) != 0 {
+		t.Errorf("without harvest = %+v, %v", list, err)
+	}
+}
@@ -0,0 +1,460 @@
+package scan
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math"
+)
+
+//ベースラインJPEGの輝度(Y成分)だけを1/fに縮小しながらデコードする
+//MCUの1行分だけを展開するので、元の大きさの画像は作らない
+//プログレッシブ、算術符号、12bit、CMYKなどはerrNoReduce
+
+var errJPEG = errors.New("JPEGを読めません")
+
+//ジグザグの順番から8x8の位置
+var jpegZigzag = [64]int{
+	0, 1, 8, 16, 9, 2, 3, 10,
+	17, 24, 32, 25, 18, 11, 4, 5,
+	12, 19, 26, 33, 40, 48, 41, 34,
+	27, 20, 13, 6, 7, 14, 21, 28,
+	35, 42, 49, 56, 57, 50, 43, 36,
+	29, 22, 15, 23, 30, 37, 44, 51,
+	58, 59, 52, 45, 38, 31, 39, 46,
+	53, 60, 61, 54, 47, 55, 62, 63,
+}
+
+//IDCTの係数 jpegCos[x][u] = C(u)/2 * cos((2x+1)uπ/16)
+var jpegCos = func() (t [8][8]float32) {
+	for x := 0; x < 8; x++ {
+		for u := 0; u < 8; u++ {
+			c := 0.5
+			if u == 0 {
+				c = 0.5 / math.Sqrt2
+			}
+			t[x][u] = float32(c * math.Cos(float64(2*x+1)*float64(u)*math.Pi/16))
+		}
+	}
+	return
+}()
+
+type jpegHuffman struct {
+	lut     [256]uint16 //先頭8bitで引く 符号長<<8 | 値 0なら8bitより長い
+	maxcode [17]int32
+	mincode [17]int32
+	valptr  [17]int32
+	vals    []byte
+}
+
+func newJPEGHuffman(counts []byte, vals []byte) (*jpegHuffman, error) {
+	h := &jpegHuffman{vals: vals}
+	code, k := int32(0), int32(0)
+	for l := uint(1); l <= 16; l++ {
+		n := int32(counts[l-1])
+		if code+n > 1<<l {
+			return nil, fmt.Errorf("%w: ハフマン表", errJPEG)
+		}
+		h.valptr[l] = k
+		h.mincode[l] = code
+		h.maxcode[l] = code + n - 1
+		if n == 0 {
+			h.maxcode[l] = -1
+		}
+		for i := int32(0); i < n && l <= 8; i++ {
+			c := (code + i) << (8 - l)
+			for j := c; j < c+1<<(8-l); j++ {
+				h.lut[j] = uint16(l)<<8 | uint16(vals[k+i])
+			}
+		}
+		k += n
+		code = (code + n) << 1
+	}
+	return h, nil
+}
+
+//エントロピー符号化されたデータのビット読み
+type jpegBits struct {
+	data   []byte
+	pos    int
+	acc    uint32
+	n      uint
+	marker bool //マーカーに達した 以降は0を読む
+	eof    bool //マーカーの前にデータが終わった
+}
+
+func (b *jpegBits) next() byte {
+	if b.marker {
+		return 0
+	}
+	if b.pos >= len(b.data) {
+		b.eof = true
+		return 0
+	}
+	c := b.data[b.pos]
+	if c != 0xFF {
+		b.pos++
+		return c
+	}
+	if b.pos+1 < len(b.data) && b.data[b.pos+1] == 0 {
+		b.pos += 2
+		return 0xFF
+	}
+	b.marker = true
+	return 0
+}
+
+func (b *jpegBits) fill() {
+	for b.n <= 24 {
+		b.acc |= uint32(b.next()) << (24 - b.n)
+		b.n += 8
+	}
+}
+
+func (b *jpegBits) bits(n uint) int32 {
+	if n == 0 {
+		return 0
+	}
+	if b.n < n {
+		b.fill()
+	}
+	v := int32(b.acc >> (32 - n))
+	b.acc <<= n
+	b.n -= n
+	return v
+}
+
+func (b *jpegBits) decode(h *jpegHuffman) (byte, error) {
+	if b.n < 16 {
+		b.fill()
+	}
+	if e := h.lut[b.acc>>24]; e != 0 {
+		l := uint(e >> 8)
+		b.acc <<= l
+		b.n -= l
+		return byte(e), nil
+	}
+	for l := uint(9); l <= 16; l++ {
+		code := int32(b.acc >> (32 - l))
+		if code <= h.maxcode[l] {
+			b.acc <<= l
+			b.n -= l
+			return h.vals[h.valptr[l]+code-h.mincode[l]], nil
+		}
+	}
+	return 0, fmt.Errorf("%w: ハフマン符号", errJPEG)
+}
+
+//RSTマーカーの後から読み直す
+func (b *jpegBits) restart() {
+	b.acc, b.n, b.marker = 0, 0, false
+	for b.pos+1 < len(b.data) {
+		if b.data[b.pos] == 0xFF && b.data[b.pos+1] >= 0xD0 && b.data[b.pos+1] <= 0xD7 {
+			b.pos += 2
+			return
+		}
+		b.pos++
+	}
+	b.marker = true
+}
+
+func jpegExtend(v int32, t uint) int32 {
+	if v < 1<<(t-1) {
+		return v - 1<<t + 1
+	}
+	return v
+}
+
+//ブロックを1つ読む keepなら逆量子化した係数を8x8の順で返す
+//戻り値は0でない最後の係数のジグザグの順番
+func (b *jpegBits) block(coef *[64]int32, dc, ac *jpegHuffman, pred *int32, q *[64]int32, keep bool) (int, error) {
+	t, err := b.decode(dc)
+	if err != nil {
+		return 0, err
+	}
+	if t > 11 {
+		return 0, fmt.Errorf("%w: DC係数", errJPEG)
+	}
+	if t > 0 {
+		*pred += jpegExtend(b.bits(uint(t)), uint(t))
+	}
+	if keep {
+		*coef = [64]int32{}
+		coef[0] = *pred * q[0]
+	}
+	last := 0
+	for k := 1; k < 64; k++ {
+		rs, err := b.decode(ac)
+		if err != nil {
+			return 0, err
+		}
+		r, s := int(rs>>4), uint(rs&15)
+		if s == 0 {
+			if r != 15 {
+				break
+			}
+			k += 15
+			continue
+		}
+		k += r
+		if k > 63 {
+			return 0, fmt.Errorf("%w: AC係数", errJPEG)
+		}
+		v := jpegExtend(b.bits(s), s)
+		if keep {
+			coef[jpegZigzag[k]] = v * q[k]
+			last = k
+		}
+	}
+	return last, nil
+}
+
+//8x8の逆DCT dstの行の間隔はstride
+func jpegIDCT(dst []byte, stride int, coef *[64]int32, last int) {
+	if last == 0 {
+		v := clampByte(float32(coef[0])/8 + 128)
+		for y := 0; y < 8; y++ {
+			row := dst[y*stride : y*stride+8]
+			for x := range row {
+				row[x] = v
+			}
+		}
+		return
+	}
+	var tmp [64]float32
+	for v := 0; v < 8; v++ {
+		for x := 0; x < 8; x++ {
+			var sum float32
+			for u := 0; u < 8; u++ {
+				sum += jpegCos[x][u] * float32(coef[v*8+u])
+			}
+			tmp[v*8+x] = sum
+		}
+	}
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			var sum float32
+			for v := 0; v < 8; v++ {
+				sum += jpegCos[y][v] * tmp[v*8+x]
+			}
+			dst[y*stride+x] = clampByte(sum + 128)
+		}
+	}
+}
+
+func clampByte(v float32) uint8 {
+	switch {
+	case v < 0:
+		return 0
+	case v > 255:
+		return 255
+	}
+	return uint8(v + 0.5)
+}
+
+type jpegComponent struct {
+	id     byte
+	h, v   int
+	tq     int
+	td, ta int
+}
+
+func decodeJPEGReduced(data []byte, f int) (*image.Gray, error) {
+	if len(data) < 2 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, errNoReduce
+	}
+	var (
+		width, height int
+		comps         []jpegComponent
+		qt            [4][64]int32
+		dc, ac        [4]*jpegHuffman
+		restart       int
+		adobe         = -1
+	)
+	pos := 2
+	for {
+		for pos < len(data) && data[pos] != 0xFF {
+			pos++
+		}
+		for pos < len(data) && data[pos] == 0xFF {
+			pos++
+		}
+		if pos >= len(data) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		marker := data[pos]
+		pos++
+		if marker == 0xD8 || marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			continue
+		}
+		if marker == 0xD9 {
+			return nil, fmt.Errorf("%w: SOSがありません", errJPEG)
+		}
+		if pos+2 > len(data) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		n := int(data[pos])<<8 | int(data[pos+1])
+		if n < 2 || pos+n > len(data) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		seg := data[pos+2 : pos+n]
+		pos += n
+		switch marker {
+		case 0xC0, 0xC1:
+			if len(seg) < 6 || seg[0] != 8 {
+				return nil, errNoReduce
+			}
+			height, width = int(seg[1])<<8|int(seg[2]), int(seg[3])<<8|int(seg[4])
+			nc := int(seg[5])
+			if height == 0 || width == 0 || (nc != 1 && nc != 3) || len(seg) < 6+3*nc {
+				return nil, errNoReduce
+			}
+			comps = make([]jpegComponent, nc)
+			for i := range comps {
+				c := seg[6+3*i:]
+				comps[i] = jpegComponent{id: c[0], h: int(c[1] >> 4), v: int(c[1] & 15), tq: int(c[2])}
+				if comps[i].h < 1 || comps[i].h > 4 || comps[i].v < 1 || comps[i].v > 4 || comps[i].tq > 3 {
+					return nil, fmt.Errorf("%w: SOF", errJPEG)
+				}
+			}
+		case 0xC4:
+			for len(seg) >= 17 {
+				class, id := seg[0]>>4, seg[0]&15
+				total := 0
+				for _, c := range seg[1:17] {
+					total += int(c)
+				}
+				if class > 1 || id > 3 || len(seg) < 17+total {
+					return nil, fmt.Errorf("%w: DHT", errJPEG)
+				}
+				h, err := newJPEGHuffman(seg[1:17], seg[17:17+total])
+				if err != nil {
+					return nil, err
+				}
+				if class == 0 {
+					dc[id] = h
+				} else {
+					ac[id] = h
+				}
+				seg = seg[17+total:]
+			}
+		case 0xDB:
+			for len(seg) >= 65 {
+				pq, tq := seg[0]>>4, seg[0]&15
+				if tq > 3 || pq > 1 || len(seg) < 65+64*int(pq) {
+					return nil, fmt.Errorf("%w: DQT", errJPEG)
+				}
+				for i := range qt[tq] {
+					if pq == 0 {
+						qt[tq][i] = int32(seg[1+i])
+					} else {
+						qt[tq][i] = int32(seg[1+2*i])<<8 | int32(seg[2+2*i])
+					}
+				}
+				seg = seg[65+64*int(pq):]
+			}
+		case 0xDD:
+			if len(seg) >= 2 {
+				restart = int(seg[0])<<8 | int(seg[1])
+			}
+		case 0xEE:
+			if len(seg) >= 12 && string(seg[:5]) == "Adobe" {
+				adobe = int(seg[11])
+			}
+		case 0xDA:
+			if comps == nil {
+				return nil, fmt.Errorf("%w: SOFがありません", errJPEG)
+			}
+			//RGBのまま圧縮されたものはY成分がない
+			if len(comps) == 3 && (adobe == 0 || (comps[0].id == 'R' && comps[1].id == 'G' && comps[2].id == 'B')) {
+				return nil, errNoReduce
+			}
+			if len(seg) < 1 || int(seg[0]) != len(comps) || len(seg) < 1+2*len(comps) {
+				return nil, errNoReduce
+			}
+			//成分の順番はSOFと同じものだけ
+			for i := range comps {
+				id, t := seg[1+2*i], seg[2+2*i]
+				if id != comps[i].id {
+					return nil, errNoReduce
+				}
+				if t>>4 > 3 || t&15 > 3 {
+					return nil, fmt.Errorf("%w: SOS", errJPEG)
+				}
+				comps[i].td, comps[i].ta = int(t>>4), int(t&15)
+			}
+			return decodeJPEGScan(data[pos:], width, height, comps, &qt, &dc, &ac, restart, f)
+		default:
+			//SOF2以降(プログレッシブ、算術符号など)
+			if marker >= 0xC2 && marker <= 0xCF {
+				return nil, errNoReduce
+			}
+		}
+	}
+}
+
+//インターリーブされた1つのスキャンを読み、Y成分を縮小する
+func decodeJPEGScan(data []byte, width, height int, comps []jpegComponent, qt *[4][64]int32, dc, ac *[4]*jpegHuffman, restart, f int) (*image.Gray, error) {
+	for _, c := range comps {
+		if dc[c.td] == nil || ac[c.ta] == nil {
+			return nil, fmt.Errorf("%w: ハフマン表がありません", errJPEG)
+		}
+	}
+	if len(comps) == 1 {
+		//1成分はインターリーブされず、MCUは1ブロック
+		comps[0].h, comps[0].v = 1, 1
+	}
+	hmax, vmax := 1, 1
+	for _, c := range comps {
+		if c.h > hmax {
+			hmax = c.h
+		}
+		if c.v > vmax {
+			vmax = c.v
+		}
+	}
+	if comps[0].h != hmax || comps[0].v != vmax {
+		return nil, errNoReduce
+	}
+	mcuW, mcuH := 8*hmax, 8*vmax
+	mx, my := (width+mcuW-1)/mcuW, (height+mcuH-1)/mcuH
+	stride := mx * mcuW
+	ybuf := make([]byte, stride*mcuH)
+	s := newShrinker(width, height, f)
+	b := &jpegBits{data: data}
+	var coef [64]int32
+	preds := make([]int32, len(comps))
+	n := 0
+	for row := 0; row < my; row++ {
+		for col := 0; col < mx; col++ {
+			if restart > 0 && n > 0 && n%restart == 0 {
+				b.restart()
+				for i := range preds {
+					preds[i] = 0
+				}
+			}
+			n++
+			for ci, c := range comps {
+				for by := 0; by < c.v; by++ {
+					for bx := 0; bx < c.h; bx++ {
+						last, err := b.block(&coef, dc[c.td], ac[c.ta], &preds[ci], &qt[c.tq], ci == 0)
+						if err != nil {
+							return nil, err
+						}
+						if ci == 0 {
+							jpegIDCT(ybuf[by*8*stride+col*mcuW+bx*8:], stride, &coef, last)
+						}
+					}
+				}
+			}
+		}
+		for y := 0; y < mcuH && row*mcuH+y < height; y++ {
+			s.row(ybuf[y*stride:])
+		}
+	}
+	if b.eof {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return s.dst, nil
+}
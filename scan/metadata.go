@@ -0,0 +1,153 @@
+package scan
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/y9o/isbn2title/isbn"
+)
+
+//メタデータファイルの種類 ParseMetadataの順に読む
+const (
+	MetaComicInfo = "comicinfo" //ComicInfo.xmlのGTIN
+	MetaOPF       = "opf"       //metadata.opfなど*.opfのdc:identifier
+	MetaNFO       = "nfo"       //*.nfoの本文
+)
+
+var errMetadata = errors.New("-metadataはcomicinfo,opf,nfoを,区切りで指定してください")
+
+//メタデータを読む順番 空なら読まない
+func ParseMetadata(s string) ([]string, error) {
+	var list []string
+	seen := map[string]bool{}
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(strings.ToLower(v))
+		switch v {
+		case "":
+			continue
+		case MetaComicInfo, MetaOPF, MetaNFO:
+		default:
+			return nil, fmt.Errorf("%w: %s", errMetadata, v)
+		}
+		if !seen[v] {
+			seen[v] = true
+			list = append(list, v)
+		}
+	}
+	return list, nil
+}
+
+//ファイル名からメタデータの種類 該当しなければ空
+func metadataKind(name string) string {
+	base := path.Base(filepath.ToSlash(name))
+	switch {
+	case strings.EqualFold(base, "ComicInfo.xml"):
+		return MetaComicInfo
+	case strings.EqualFold(path.Ext(base), ".opf"):
+		return MetaOPF
+	case strings.EqualFold(path.Ext(base), ".nfo"):
+		return MetaNFO
+	}
+	return ""
+}
+
+//スキャンする前にフォルダ、ZIP内のメタデータからISBNを探す 見つからなければ空
+//読めないファイルは記録して次へ
+func probeMetadata(src imageSource, op *Options) Result {
+	for _, kind := range op.Metadata {
+		for _, name := range src.Names() {
+			if metadataKind(name) != kind {
+				continue
+			}
+			id, err := readMetadata(src, name, kind)
+			if err != nil {
+				op.logf("%s: %s\n", name, err)
+				continue
+			}
+			if id != "" {
+				op.logf("Metadata: %s\n", name)
+				return Result{ISBN: id, Votes: op.confirmCount(), File: name}
+			}
+		}
+	}
+	return Result{}
+}
+
+func readMetadata(src imageSource, name, kind string) (isbn.ISBN, error) {
+	fh, err := src.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer fh.Close()
+	data, err := ioutil.ReadAll(fh)
+	if err != nil {
+		return "", err
+	}
+	switch kind {
+	case MetaComicInfo:
+		return comicInfoISBN(data)
+	case MetaOPF:
+		return opfISBN(data)
+	}
+	return firstISBN(string(data)), nil
+}
+
+func firstISBN(s string) isbn.ISBN {
+	if list := isbn.Find(s); len(list) > 0 {
+		return list[0]
+	}
+	return ""
+}
+
+//GTIN、なければNotesに書かれたISBN
+func comicInfoISBN(data []byte) (isbn.ISBN, error) {
+	var info struct {
+		GTIN  string
+		Notes string
+	}
+	if err := xml.Unmarshal(data, &info); err != nil {
+		return "", err
+	}
+	if id, err := isbn.Parse(info.GTIN); err == nil {
+		return id, nil
+	}
+	return firstISBN(info.Notes), nil
+}
+
+//scheme="ISBN"またはurn:isbn:のdc:identifierを優先 なければISBNとして正しいidentifier
+func opfISBN(data []byte) (isbn.ISBN, error) {
+	var pkg struct {
+		Identifiers []struct {
+			Scheme string `xml:"scheme,attr"`
+			Value  string `xml:",chardata"`
+		} `xml:"metadata>identifier"`
+	}
+	if err := xml.Unmarshal(data, &pkg); err != nil {
+		return "", err
+	}
+	var other isbn.ISBN
+	for _, v := range pkg.Identifiers {
+		s := strings.TrimSpace(v.Value)
+		marked := strings.EqualFold(v.Scheme, "ISBN")
+		if len(s) > 9 && strings.EqualFold(s[:9], "urn:isbn:") {
+			s = s[9:]
+			marked = true
+		}
+		id, err := isbn.Parse(s)
+		if err != nil {
+			continue
+		}
+		if marked {
+			return id, nil
+		}
+		if other == "" {
+			other = id
+		}
+	}
+	return other, nil
+}
@@ -0,0 +1,100 @@
+package scan
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testComicInfo = `<?xml version="1.0" encoding="utf-8"?>
+<ComicInfo xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+  <Title>ONE PIECE</Title>
+  <GTIN>978-4-08-872509-3</GTIN>
+</ComicInfo>`
+
+const testOPF = `<?xml version="1.0" encoding="utf-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="2.0">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:opf="http://www.idpf.org/2007/opf">
+    <dc:identifier opf:scheme="calibre">9784088725093</dc:identifier>
+    <dc:identifier opf:scheme="ISBN">080442957X</dc:identifier>
+  </metadata>
+</package>`
+
+func TestParseMetadata(t *testing.T) {
+	list, err := ParseMetadata("nfo, ComicInfo,nfo")
+	if err != nil || len(list) != 2 || list[0] != MetaNFO || list[1] != MetaComicInfo {
+		t.Errorf("ParseMetadata = %v, %v", list, err)
+	}
+	if list, err := ParseMetadata(""); err != nil || len(list) != 0 {
+		t.Errorf("ParseMetadata(\"\") = %v, %v", list, err)
+	}
+	if _, err := ParseMetadata("xmp"); err == nil {
+		t.Error("ParseMetadata(xmp) accepted")
+	}
+}
+
+func TestMetadataFormats(t *testing.T) {
+	id, err := comicInfoISBN([]byte(testComicInfo))
+	if err != nil || id != "9784088725093" {
+		t.Errorf("comicInfoISBN = %q, %v", id, err)
+	}
+	//scheme="ISBN"を優先
+	id, err = opfISBN([]byte(testOPF))
+	if err != nil || id != "9780804429573" {
+		t.Errorf("opfISBN = %q, %v", id, err)
+	}
+	id, err = opfISBN([]byte(`<package><metadata><identifier>urn:isbn:9784088725093</identifier></metadata></package>`))
+	if err != nil || id != "9784088725093" {
+		t.Errorf("opfISBN(urn) = %q, %v", id, err)
+	}
+	if _, err := comicInfoISBN([]byte("<ComicInfo>")); err == nil {
+		t.Error("comicInfoISBN accepted broken xml")
+	}
+}
+
+func TestProbeMetadata(t *testing.T) {
+	dir, err := ioutil.TempDir("", "isbn2title")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"ComicInfo.xml": testComicInfo,
+		"metadata.opf":  testOPF,
+		"release.nfo":   "Title: test\r\nISBN: 978-4-08-872509-4\r\nISBN-10: 0-8044-2957-X\r\n",
+	}
+	for name, body := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeTestImage(t, filepath.Join(dir, "001.png"), testCover(t, "9784088725093"))
+
+	for _, tc := range []struct {
+		order string
+		isbn  string
+		file  string
+	}{
+		{"comicinfo,opf,nfo", "9784088725093", "ComicInfo.xml"},
+		{"opf,comicinfo", "9780804429573", "metadata.opf"},
+		{"nfo", "9780804429573", "release.nfo"},
+	} {
+		order, err := ParseMetadata(tc.order)
+		if err != nil {
+			t.Fatal(err)
+		}
+		list, err := ScanDir(context.Background(), dir, Options{Head: 1, Metadata: order})
+		if err != nil || len(list) != 1 || string(list[0].ISBN) != tc.isbn || list[0].File != tc.file || !list[0].confirmed() {
+			t.Errorf("%s: %+v, %v", tc.order, list, err)
+		}
+	}
+
+	//メタデータを読まなければスキャンする
+	list, err := ScanDir(context.Background(), dir, Options{Head: 1, NoRotate: true})
+	if err != nil || len(list) != 1 || list[0].File != "001.png" {
+		t.Errorf("no metadata: %+v, %v", list, err)
+	}
+}
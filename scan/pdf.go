@@ -0,0 +1,958 @@
+package scan
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+//PDFからページ画像を取り出すための最低限のパーサー
+//xrefは使わず "N G obj" を探して索引を作る
+
+type pdfName string
+type pdfDict map[pdfName]interface{}
+type pdfRef struct {
+	num, gen int
+}
+type pdfStream struct {
+	dict pdfDict
+	data []byte
+}
+
+var errPDFSyntax = errors.New("PDFの解析に失敗しました")
+var errPDFFilter = errors.New("対応していない圧縮形式です")
+
+var pdfObjHeader = regexp.MustCompile(`(\d+)[ \t\r\n\f\x00]+(\d+)[ \t\r\n\f\x00]+obj\b`)
+
+type pdfFile struct {
+	data    []byte
+	offsets map[int]int
+	objs    map[int]interface{}
+	//オブジェクトストリーム内のオブジェクト
+	inStm   map[int][2]int
+	stmData map[int][]byte
+}
+
+func readPDF(data []byte) (*pdfFile, error) {
+	pdf := &pdfFile{
+		data:    data,
+		offsets: map[int]int{},
+		objs:    map[int]interface{}{},
+		inStm:   map[int][2]int{},
+		stmData: map[int][]byte{},
+	}
+	if !bytes.HasPrefix(data, []byte("%PDF")) {
+		return nil, fmt.Errorf("%w: %%PDFで始まりません", errPDFSyntax)
+	}
+	//後から追記されたオブジェクトが優先
+	for _, m := range pdfObjHeader.FindAllSubmatchIndex(data, -1) {
+		if m[0] > 0 && !isPDFSpace(data[m[0]-1]) {
+			continue
+		}
+		num, _ := strconv.Atoi(string(data[m[2]:m[3]]))
+		pdf.offsets[num] = m[1]
+	}
+	for num := range pdf.offsets {
+		stm, ok := pdf.object(num).(*pdfStream)
+		if !ok || stm.dict["Type"] != pdfName("ObjStm") {
+			continue
+		}
+		pdf.indexObjStm(num, stm)
+	}
+	//並列に読めるように全て読み込んでおく
+	pdf.objs = map[int]interface{}{}
+	for num := range pdf.offsets {
+		pdf.object(num)
+	}
+	for num := range pdf.inStm {
+		pdf.object(num)
+	}
+	return pdf, nil
+}
+
+//オブジェクトストリームの目次を読む
+func (pdf *pdfFile) indexObjStm(num int, stm *pdfStream) {
+	data, err := pdf.decodeStream(stm)
+	if err != nil {
+		return
+	}
+	n, _ := pdf.resolve(stm.dict["N"]).(int)
+	p := &pdfParser{data: data}
+	for i := 0; i < n; i++ {
+		objnum, ok1 := p.parse().(int)
+		_, ok2 := p.parse().(int)
+		if !ok1 || !ok2 {
+			return
+		}
+		if _, ok := pdf.offsets[objnum]; !ok {
+			pdf.inStm[objnum] = [2]int{num, i}
+		}
+	}
+}
+
+func (pdf *pdfFile) object(num int) interface{} {
+	if obj, ok := pdf.objs[num]; ok {
+		return obj
+	}
+	off, ok := pdf.offsets[num]
+	loc, inStm := pdf.inStm[num]
+	if !ok && !inStm {
+		return nil
+	}
+	//循環参照対策
+	pdf.objs[num] = nil
+	var obj interface{}
+	if ok {
+		obj = pdf.parseAt(off)
+	} else {
+		obj = pdf.objectInStm(loc[0], loc[1])
+	}
+	pdf.objs[num] = obj
+	return obj
+}
+
+func (pdf *pdfFile) objectInStm(stmnum, idx int) interface{} {
+	stm, ok := pdf.object(stmnum).(*pdfStream)
+	if !ok {
+		return nil
+	}
+	data, ok := pdf.stmData[stmnum]
+	if !ok {
+		var err error
+		data, err = pdf.decodeStream(stm)
+		if err != nil {
+			return nil
+		}
+		pdf.stmData[stmnum] = data
+	}
+	n, _ := pdf.resolve(stm.dict["N"]).(int)
+	first, _ := pdf.resolve(stm.dict["First"]).(int)
+	p := &pdfParser{data: data}
+	for i := 0; i < n; i++ {
+		p.parse()
+		off, _ := p.parse().(int)
+		if i == idx {
+			if first < 0 || off < 0 || first+off >= len(data) {
+				return nil
+			}
+			return (&pdfParser{data: data, pos: first + off}).parse()
+		}
+	}
+	return nil
+}
+
+//"obj"の直後からオブジェクトを読む ストリームならデータも読む
+func (pdf *pdfFile) parseAt(off int) interface{} {
+	p := &pdfParser{data: pdf.data, pos: off}
+	obj := p.parse()
+	dict, ok := obj.(pdfDict)
+	if !ok {
+		return obj
+	}
+	p.skipSpace()
+	if p.pos >= len(pdf.data) || !bytes.HasPrefix(pdf.data[p.pos:], []byte("stream")) {
+		return obj
+	}
+	start := p.pos + len("stream")
+	if start < len(pdf.data) && pdf.data[start] == '\r' {
+		start++
+	}
+	if start < len(pdf.data) && pdf.data[start] == '\n' {
+		start++
+	}
+	length, _ := pdf.resolve(dict["Length"]).(int)
+	end := start + length
+	if length <= 0 || end > len(pdf.data) || !bytes.Contains(pdf.data[end:minInt(end+12, len(pdf.data))], []byte("endstream")) {
+		//Lengthが信用できない場合
+		i := bytes.Index(pdf.data[start:], []byte("endstream"))
+		if i < 0 {
+			return obj
+		}
+		end = start + i
+		for end > start && (pdf.data[end-1] == '\n' || pdf.data[end-1] == '\r') {
+			end--
+		}
+	}
+	return &pdfStream{dict: dict, data: pdf.data[start:end]}
+}
+
+func (pdf *pdfFile) resolve(obj interface{}) interface{} {
+	for i := 0; i < 32; i++ {
+		ref, ok := obj.(pdfRef)
+		if !ok {
+			return obj
+		}
+		obj = pdf.object(ref.num)
+	}
+	return nil
+}
+
+func (pdf *pdfFile) dict(obj interface{}) pdfDict {
+	switch v := pdf.resolve(obj).(type) {
+	case pdfDict:
+		return v
+	case *pdfStream:
+		return v.dict
+	}
+	return nil
+}
+
+func (pdf *pdfFile) array(obj interface{}) []interface{} {
+	v, _ := pdf.resolve(obj).([]interface{})
+	return v
+}
+
+func (pdf *pdfFile) number(obj interface{}) int {
+	switch v := pdf.resolve(obj).(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	}
+	return 0
+}
+
+//ページ順に画像XObjectを集める
+func (pdf *pdfFile) pageImages() [][]*pdfStream {
+	var catalog pdfDict
+	nums := make([]int, 0, len(pdf.offsets)+len(pdf.inStm))
+	for num := range pdf.offsets {
+		nums = append(nums, num)
+	}
+	for num := range pdf.inStm {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	for _, num := range nums {
+		if d := pdf.dict(pdfRef{num: num}); d != nil && d["Type"] == pdfName("Catalog") {
+			catalog = d
+		}
+	}
+	if catalog == nil {
+		return nil
+	}
+	var pages [][]*pdfStream
+	var walk func(node pdfDict, res interface{}, depth int)
+	walk = func(node pdfDict, res interface{}, depth int) {
+		if node == nil || depth > 64 {
+			return
+		}
+		if r, ok := node["Resources"]; ok {
+			res = r
+		}
+		if node["Type"] == pdfName("Pages") || node["Kids"] != nil {
+			for _, kid := range pdf.array(node["Kids"]) {
+				walk(pdf.dict(kid), res, depth+1)
+			}
+			return
+		}
+		pages = append(pages, pdf.xobjectImages(res, 0))
+	}
+	walk(pdf.dict(catalog["Pages"]), nil, 0)
+	return pages
+}
+
+func (pdf *pdfFile) xobjectImages(res interface{}, depth int) []*pdfStream {
+	xobj := pdf.dict(pdf.dict(res)["XObject"])
+	names := make([]string, 0, len(xobj))
+	for name := range xobj {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+	var list []*pdfStream
+	for _, name := range names {
+		stm, ok := pdf.resolve(xobj[pdfName(name)]).(*pdfStream)
+		if !ok {
+			continue
+		}
+		switch stm.dict["Subtype"] {
+		case pdfName("Image"):
+			list = append(list, stm)
+		case pdfName("Form"):
+			//フォームの中の画像
+			if depth < 4 {
+				list = append(list, pdf.xobjectImages(stm.dict["Resources"], depth+1)...)
+			}
+		}
+	}
+	return list
+}
+
+func (pdf *pdfFile) filters(stm *pdfStream) ([]pdfName, []pdfDict) {
+	var names []pdfName
+	var parms []pdfDict
+	switch f := pdf.resolve(stm.dict["Filter"]).(type) {
+	case pdfName:
+		names = append(names, f)
+		parms = append(parms, pdf.dict(stm.dict["DecodeParms"]))
+	case []interface{}:
+		p := pdf.array(stm.dict["DecodeParms"])
+		for i, v := range f {
+			name, _ := pdf.resolve(v).(pdfName)
+			names = append(names, name)
+			if i < len(p) {
+				parms = append(parms, pdf.dict(p[i]))
+			} else {
+				parms = append(parms, nil)
+			}
+		}
+	}
+	return names, parms
+}
+
+//Flateだけ展開する DCTDecodeは残す
+func (pdf *pdfFile) decodeStream(stm *pdfStream) ([]byte, error) {
+	data := stm.data
+	names, parms := pdf.filters(stm)
+	for i, name := range names {
+		switch name {
+		case "FlateDecode", "Fl":
+			var err error
+			data, err = inflate(data)
+			if err != nil {
+				return nil, err
+			}
+			data, err = pdf.unpredict(data, parms[i])
+			if err != nil {
+				return nil, err
+			}
+		case "DCTDecode", "DCT":
+			if i != len(names)-1 {
+				return nil, errPDFFilter
+			}
+			return data, nil
+		default:
+			return nil, fmt.Errorf("%w: %s", errPDFFilter, name)
+		}
+	}
+	return data, nil
+}
+
+func inflate(data []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		//zlibヘッダが無い場合
+		return ioutil.ReadAll(flate.NewReader(bytes.NewReader(data)))
+	}
+	defer zr.Close()
+	out, err := ioutil.ReadAll(zr)
+	if err != nil && len(out) == 0 {
+		return nil, err
+	}
+	return out, nil
+}
+
+//PNG Predictor を戻す
+func (pdf *pdfFile) unpredict(data []byte, parms pdfDict) ([]byte, error) {
+	predictor := pdf.number(parms["Predictor"])
+	if predictor < 10 {
+		if predictor == 2 {
+			return nil, fmt.Errorf("%w: TIFF Predictor", errPDFFilter)
+		}
+		return data, nil
+	}
+	colors, bpc, columns := 1, 8, 1
+	if v := pdf.number(parms["Colors"]); v > 0 {
+		colors = v
+	}
+	if v := pdf.number(parms["BitsPerComponent"]); v > 0 {
+		bpc = v
+	}
+	if v := pdf.number(parms["Columns"]); v > 0 {
+		columns = v
+	}
+	if colors > 32 || bpc > 16 || columns > maxPDFImageSide {
+		return nil, fmt.Errorf("%w: Predictor", errPDFFilter)
+	}
+	bpp := (colors*bpc + 7) / 8
+	stride := (colors*bpc*columns + 7) / 8
+	out := make([]byte, 0, len(data))
+	prev := make([]byte, stride)
+	for pos := 0; pos+stride+1 <= len(data); pos += stride + 1 {
+		row := append([]byte(nil), data[pos+1:pos+1+stride]...)
+		unfilterRow(data[pos], row, prev, bpp)
+		out = append(out, row...)
+		prev = row
+	}
+	return out, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := absInt(p-int(a)), absInt(p-int(b)), absInt(p-int(c))
+	if pa <= pb && pa <= pc {
+		return a
+	}
+	if pb <= pc {
+		return b
+	}
+	return c
+}
+
+//画像XObjectをデコード
+func (pdf *pdfFile) decodeImage(stm *pdfStream) (image.Image, error) {
+	data, err := pdf.decodeStream(stm)
+	if err != nil {
+		return nil, err
+	}
+	names, _ := pdf.filters(stm)
+	if len(names) > 0 && (names[len(names)-1] == "DCTDecode" || names[len(names)-1] == "DCT") {
+		return jpeg.Decode(bytes.NewReader(data))
+	}
+
+	width, height, bpc, comps, palette, err := pdf.imageHeader(stm)
+	if err != nil {
+		return nil, err
+	}
+	stride := (width*comps*bpc + 7) / 8
+	if height > len(data)/stride {
+		return nil, fmt.Errorf("%w: 画像データが足りません", errPDFSyntax)
+	}
+	maxv := (1 << uint(bpc)) - 1
+	sample := func(row []byte, i int) int {
+		bit := i * bpc
+		v := int(row[bit/8])
+		shift := 8 - bpc - bit%8
+		return (v >> uint(shift)) & maxv
+	}
+	rect := image.Rect(0, 0, width, height)
+	switch {
+	case palette != nil:
+		img := image.NewPaletted(rect, palette)
+		for y := 0; y < height; y++ {
+			row := data[y*stride : (y+1)*stride]
+			for x := 0; x < width; x++ {
+				idx := sample(row, x)
+				if idx >= len(palette) {
+					idx = len(palette) - 1
+				}
+				img.Pix[y*img.Stride+x] = uint8(idx)
+			}
+		}
+		return img, nil
+	case comps == 1:
+		img := image.NewGray(rect)
+		for y := 0; y < height; y++ {
+			row := data[y*stride : (y+1)*stride]
+			for x := 0; x < width; x++ {
+				img.Pix[y*img.Stride+x] = uint8(sample(row, x) * 255 / maxv)
+			}
+		}
+		return img, nil
+	case comps == 3:
+		img := image.NewRGBA(rect)
+		for y := 0; y < height; y++ {
+			row := data[y*stride : (y+1)*stride]
+			for x := 0; x < width; x++ {
+				p := img.Pix[y*img.Stride+x*4:]
+				p[0] = uint8(sample(row, x*3) * 255 / maxv)
+				p[1] = uint8(sample(row, x*3+1) * 255 / maxv)
+				p[2] = uint8(sample(row, x*3+2) * 255 / maxv)
+				p[3] = 255
+			}
+		}
+		return img, nil
+	case comps == 4:
+		img := image.NewCMYK(rect)
+		for y := 0; y < height; y++ {
+			row := data[y*stride : (y+1)*stride]
+			for x := 0; x < width; x++ {
+				for c := 0; c < 4; c++ {
+					img.Pix[y*img.Stride+x*4+c] = uint8(sample(row, x*4+c) * 255 / maxv)
+				}
+			}
+		}
+		return img, nil
+	}
+	return nil, fmt.Errorf("%w: 色空間", errPDFFilter)
+}
+
+//画像XObjectの大きさと色
+func (pdf *pdfFile) imageHeader(stm *pdfStream) (width, height, bpc, comps int, palette color.Palette, err error) {
+	width = pdf.number(stm.dict["Width"])
+	height = pdf.number(stm.dict["Height"])
+	bpc = pdf.number(stm.dict["BitsPerComponent"])
+	if mask, _ := pdf.resolve(stm.dict["ImageMask"]).(bool); mask {
+		bpc = 1
+	}
+	//幅×成分数×ビット数がintで溢れないように1辺を制限する
+	if width <= 0 || height <= 0 || width > maxPDFImageSide || height > maxPDFImageSide || (bpc != 1 && bpc != 2 && bpc != 4 && bpc != 8) {
+		err = fmt.Errorf("%w: 画像サイズ", errPDFSyntax)
+		return
+	}
+	comps, palette, err = pdf.colorSpace(stm.dict["ColorSpace"])
+	if err == nil && comps != 1 && comps != 3 && comps != 4 {
+		err = fmt.Errorf("%w: 色空間", errPDFFilter)
+	}
+	return
+}
+
+//PDFの画像の1辺の上限
+const maxPDFImageSide = 1 << 24
+
+//画像XObjectを展開しながら1/fに縮小する
+//圧縮なし、FlateDecode1つ、DCTDecodeのみ それ以外はerrNoReduce
+func (pdf *pdfFile) decodeImageReduced(stm *pdfStream, f int) (*image.Gray, error) {
+	names, parms := pdf.filters(stm)
+	if len(names) == 1 && (names[0] == "DCTDecode" || names[0] == "DCT") {
+		return decodeJPEGReduced(stm.data, f)
+	}
+	width, height, bpc, comps, palette, err := pdf.imageHeader(stm)
+	if err != nil {
+		return nil, err
+	}
+	rf := &rowFormat{comps: comps, bpc: bpc}
+	for _, c := range palette {
+		rf.palette = append(rf.palette, color.GrayModel.Convert(c).(color.Gray).Y)
+	}
+	var r io.Reader = bytes.NewReader(stm.data)
+	filtered := false
+	expand := 1 //展開後のデータの最大の倍率
+	switch {
+	case len(names) == 0:
+	case len(names) == 1 && (names[0] == "FlateDecode" || names[0] == "Fl"):
+		if zr, err := zlib.NewReader(r); err == nil {
+			defer zr.Close()
+			r = zr
+		} else {
+			//zlibヘッダが無い場合
+			r = flate.NewReader(bytes.NewReader(stm.data))
+		}
+		expand = 1032
+		p := parms[0]
+		switch predictor := pdf.number(p["Predictor"]); {
+		case predictor == 2:
+			return nil, fmt.Errorf("%w: TIFF Predictor", errPDFFilter)
+		case predictor >= 10:
+			for k, v := range map[pdfName]int{"Columns": width, "Colors": comps, "BitsPerComponent": bpc} {
+				if n := pdf.number(p[k]); n > 0 && n != v {
+					return nil, errNoReduce
+				}
+			}
+			filtered = true
+		}
+	default:
+		return nil, errNoReduce
+	}
+	//データより大きい画像を確保しない
+	stride := rf.stride(width)
+	if filtered {
+		stride++
+	}
+	if height/expand > len(stm.data)/stride {
+		return nil, fmt.Errorf("%w: 画像データが足りません", errPDFSyntax)
+	}
+	img, err := shrinkRows(r, rf, width, height, f, filtered)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("%w: 画像データが足りません", errPDFSyntax)
+	}
+	return img, err
+}
+
+//色の成分数 Indexedならパレットも返す
+func (pdf *pdfFile) colorSpace(obj interface{}) (int, color.Palette, error) {
+	switch cs := pdf.resolve(obj).(type) {
+	case nil:
+		return 1, nil, nil
+	case pdfName:
+		switch cs {
+		case "DeviceGray", "CalGray", "G":
+			return 1, nil, nil
+		case "DeviceRGB", "CalRGB", "RGB":
+			return 3, nil, nil
+		case "DeviceCMYK", "CMYK":
+			return 4, nil, nil
+		}
+	case []interface{}:
+		if len(cs) == 0 {
+			break
+		}
+		switch pdf.resolve(cs[0]) {
+		case pdfName("ICCBased"):
+			if len(cs) > 1 {
+				if n := pdf.number(pdf.dict(cs[1])["N"]); n > 0 {
+					return n, nil, nil
+				}
+			}
+		case pdfName("CalGray"):
+			return 1, nil, nil
+		case pdfName("CalRGB"):
+			return 3, nil, nil
+		case pdfName("Indexed"), pdfName("I"):
+			if len(cs) < 4 {
+				break
+			}
+			base, _, err := pdf.colorSpace(cs[1])
+			if err != nil {
+				return 0, nil, err
+			}
+			var lookup []byte
+			switch v := pdf.resolve(cs[3]).(type) {
+			case string:
+				lookup = []byte(v)
+			case *pdfStream:
+				lookup, err = pdf.decodeStream(v)
+				if err != nil {
+					return 0, nil, err
+				}
+			}
+			hival := pdf.number(cs[2])
+			var palette color.Palette
+			for i := 0; i <= hival && (i+1)*base <= len(lookup); i++ {
+				c := lookup[i*base : (i+1)*base]
+				switch base {
+				case 1:
+					palette = append(palette, color.Gray{Y: c[0]})
+				case 3:
+					palette = append(palette, color.RGBA{R: c[0], G: c[1], B: c[2], A: 255})
+				case 4:
+					palette = append(palette, color.CMYK{C: c[0], M: c[1], Y: c[2], K: c[3]})
+				}
+			}
+			if len(palette) == 0 {
+				break
+			}
+			return 1, palette, nil
+		}
+	}
+	return 0, nil, fmt.Errorf("%w: 色空間 %v", errPDFFilter, obj)
+}
+
+type pdfParser struct {
+	data []byte
+	pos  int
+}
+
+func isPDFSpace(c byte) bool {
+	switch c {
+	case ' ', '\t', '\r', '\n', '\f', 0:
+		return true
+	}
+	return false
+}
+
+func isPDFDelimiter(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return isPDFSpace(c)
+}
+
+//途中で切れたデータで末尾を越えないようにする
+func (p *pdfParser) clamp() {
+	if p.pos > len(p.data) {
+		p.pos = len(p.data)
+	}
+}
+
+func (p *pdfParser) skipSpace() {
+	p.clamp()
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		if c == '%' {
+			for p.pos < len(p.data) && p.data[p.pos] != '\n' && p.data[p.pos] != '\r' {
+				p.pos++
+			}
+			continue
+		}
+		if !isPDFSpace(c) {
+			return
+		}
+		p.pos++
+	}
+}
+
+func (p *pdfParser) token() string {
+	p.clamp()
+	start := p.pos
+	for p.pos < len(p.data) && !isPDFDelimiter(p.data[p.pos]) {
+		p.pos++
+	}
+	return string(p.data[start:p.pos])
+}
+
+//オブジェクトを1つ読む 解析できなければnil
+func (p *pdfParser) parse() interface{} {
+	defer p.clamp()
+	p.skipSpace()
+	if p.pos >= len(p.data) {
+		return nil
+	}
+	switch c := p.data[p.pos]; c {
+	case '<':
+		if p.pos+1 < len(p.data) && p.data[p.pos+1] == '<' {
+			p.pos += 2
+			dict := pdfDict{}
+			for {
+				p.skipSpace()
+				if p.pos >= len(p.data) {
+					return dict
+				}
+				if bytes.HasPrefix(p.data[p.pos:], []byte(">>")) {
+					p.pos += 2
+					return dict
+				}
+				key, ok := p.parse().(pdfName)
+				if !ok {
+					return dict
+				}
+				dict[key] = p.parse()
+			}
+		}
+		p.pos++
+		var hex []byte
+		for p.pos < len(p.data) && p.data[p.pos] != '>' {
+			if !isPDFSpace(p.data[p.pos]) {
+				hex = append(hex, p.data[p.pos])
+			}
+			p.pos++
+		}
+		p.pos++
+		if len(hex)%2 == 1 {
+			hex = append(hex, '0')
+		}
+		out := make([]byte, len(hex)/2)
+		for i := range out {
+			v, _ := strconv.ParseUint(string(hex[i*2:i*2+2]), 16, 8)
+			out[i] = byte(v)
+		}
+		return string(out)
+	case '[':
+		p.pos++
+		arr := []interface{}{}
+		for {
+			p.skipSpace()
+			if p.pos >= len(p.data) {
+				return arr
+			}
+			if p.data[p.pos] == ']' {
+				p.pos++
+				return arr
+			}
+			start := p.pos
+			arr = append(arr, p.parse())
+			if p.pos == start {
+				p.pos++
+			}
+		}
+	case '(':
+		p.pos++
+		var buf []byte
+		depth := 1
+		for p.pos < len(p.data) {
+			c := p.data[p.pos]
+			p.pos++
+			switch c {
+			case '\\':
+				if p.pos < len(p.data) {
+					e := p.data[p.pos]
+					p.pos++
+					switch e {
+					case 'n':
+						buf = append(buf, '\n')
+					case 'r':
+						buf = append(buf, '\r')
+					case 't':
+						buf = append(buf, '\t')
+					case 'b':
+						buf = append(buf, '\b')
+					case 'f':
+						buf = append(buf, '\f')
+					case '\r', '\n':
+					default:
+						if e >= '0' && e <= '7' {
+							v := int(e - '0')
+							for i := 0; i < 2 && p.pos < len(p.data) && p.data[p.pos] >= '0' && p.data[p.pos] <= '7'; i++ {
+								v = v*8 + int(p.data[p.pos]-'0')
+								p.pos++
+							}
+							buf = append(buf, byte(v))
+						} else {
+							buf = append(buf, e)
+						}
+					}
+				}
+				continue
+			case '(':
+				depth++
+			case ')':
+				depth--
+				if depth == 0 {
+					return string(buf)
+				}
+			}
+			buf = append(buf, c)
+		}
+		return string(buf)
+	case '/':
+		p.pos++
+		tok := p.token()
+		var name []byte
+		for i := 0; i < len(tok); i++ {
+			if tok[i] == '#' && i+2 < len(tok) {
+				if v, err := strconv.ParseUint(tok[i+1:i+3], 16, 8); err == nil {
+					name = append(name, byte(v))
+					i += 2
+					continue
+				}
+			}
+			name = append(name, tok[i])
+		}
+		return pdfName(name)
+	case ']', '>', ')', '{', '}':
+		return nil
+	}
+
+	tok := p.token()
+	switch tok {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "null", "":
+		return nil
+	}
+	n, err := strconv.Atoi(tok)
+	if err != nil {
+		f, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			return nil
+		}
+		return f
+	}
+	//"N G R" なら参照
+	save := p.pos
+	p.skipSpace()
+	if gen, err := strconv.Atoi(p.token()); err == nil {
+		p.skipSpace()
+		if p.token() == "R" {
+			return pdfRef{num: n, gen: gen}
+		}
+	}
+	p.pos = save
+	return n
+}
+
+//PDFの画像を読み込み元として扱う
+type pdfSource struct {
+	names  []string
+	images map[string]*pdfStream
+	pdf    *pdfFile
+}
+
+func newPDFSource(path string) (*pdfSource, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pdf, err := readPDF(data)
+	if err != nil {
+		return nil, err
+	}
+	src := &pdfSource{pdf: pdf, images: map[string]*pdfStream{}}
+	for page, list := range pdf.pageImages() {
+		for i, stm := range list {
+			name := fmt.Sprintf("page%04d", page+1)
+			if i > 0 {
+				name += fmt.Sprintf("_%d", i+1)
+			}
+			src.names = append(src.names, name)
+			src.images[name] = stm
+		}
+	}
+	if len(src.names) == 0 {
+		return nil, fmt.Errorf("%w: 画像が見つかりません", errPDFSyntax)
+	}
+	return src, nil
+}
+
+func (src *pdfSource) Names() []string {
+	return src.names
+}
+
+//JPEGのままのページだけ読める
+func (src *pdfSource) Open(name string) (io.ReadCloser, error) {
+	stm, ok := src.images[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	names, _ := src.pdf.filters(stm)
+	if len(names) != 1 || (names[0] != "DCTDecode" && names[0] != "DCT") {
+		return nil, errPDFFilter
+	}
+	return ioutil.NopCloser(bytes.NewReader(stm.data)), nil
+}
+
+//圧縮されたままのストリーム キャッシュのキーに使う
+func (src *pdfSource) Raw(name string) ([]byte, error) {
+	stm, ok := src.images[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return stm.data, nil
+}
+
+func (src *pdfSource) Decode(name string) (image.Image, error) {
+	stm, ok := src.images[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return src.pdf.decodeImage(stm)
+}
+
+func (src *pdfSource) DecodeReduced(name string, f int) (image.Image, error) {
+	stm, ok := src.images[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return src.pdf.decodeImageReduced(stm, f)
+}
+
+//辞書のサイズだけ返す データは展開しない
+func (src *pdfSource) DecodeConfig(name string) (image.Config, error) {
+	stm, ok := src.images[name]
+	if !ok {
+		return image.Config{}, os.ErrNotExist
+	}
+	cfg := image.Config{
+		Width:      src.pdf.number(stm.dict["Width"]),
+		Height:     src.pdf.number(stm.dict["Height"]),
+		ColorModel: color.RGBAModel,
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return cfg, fmt.Errorf("%w: 画像サイズ", errPDFSyntax)
+	}
+	return cfg, nil
+}
+
+func (src *pdfSource) Close() error {
+	src.pdf = nil
+	src.images = nil
+	return nil
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func absInt(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
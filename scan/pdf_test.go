@@ -0,0 +1,157 @@
+package scan
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+//1ページ目にJPEG、2ページ目にFlate(PNG Predictor)の画像を持つPDF
+func testPDF(t *testing.T, jpg, flat *image.Gray) []byte {
+	var jbuf bytes.Buffer
+	if err := jpeg.Encode(&jbuf, jpg, nil); err != nil {
+		t.Fatal(err)
+	}
+	var raw bytes.Buffer
+	w, h := flat.Bounds().Dx(), flat.Bounds().Dy()
+	prev := make([]byte, w)
+	for y := 0; y < h; y++ {
+		//PNG Up フィルタ
+		row := flat.Pix[y*flat.Stride : y*flat.Stride+w]
+		raw.WriteByte(2)
+		for x := range row {
+			raw.WriteByte(row[x] - prev[x])
+		}
+		prev = row
+	}
+	var zbuf bytes.Buffer
+	zw := zlib.NewWriter(&zbuf)
+	zw.Write(raw.Bytes())
+	zw.Close()
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	fmt.Fprintf(&buf, "1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+	fmt.Fprintf(&buf, "2 0 obj\n<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 >>\nendobj\n")
+	fmt.Fprintf(&buf, "3 0 obj\n<< /Type /Page /Parent 2 0 R /Resources << /XObject << /Im0 5 0 R >> >> >>\nendobj\n")
+	fmt.Fprintf(&buf, "4 0 obj\n<< /Type /Page /Parent 2 0 R /Resources << /XObject << /Im0 6 0 R >> >> >>\nendobj\n")
+	fmt.Fprintf(&buf, "5 0 obj\n<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceGray /BitsPerComponent 8 /Filter /DCTDecode /Length %d >>\nstream\n",
+		jpg.Bounds().Dx(), jpg.Bounds().Dy(), jbuf.Len())
+	buf.Write(jbuf.Bytes())
+	buf.WriteString("\nendstream\nendobj\n")
+	fmt.Fprintf(&buf, "6 0 obj\n<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceGray /BitsPerComponent 8 /Filter /FlateDecode /DecodeParms << /Predictor 15 /Columns %d >> /Length 7 0 R >>\nstream\n",
+		w, h, w)
+	buf.Write(zbuf.Bytes())
+	buf.WriteString("\nendstream\nendobj\n")
+	fmt.Fprintf(&buf, "7 0 obj\n%d\nendobj\n", zbuf.Len())
+	buf.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+	return buf.Bytes()
+}
+
+func TestPDFSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "isbn2title")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "book.pdf")
+	if err := ioutil.WriteFile(path, testPDF(t, testCover(t), testCover(t, "9784088725093")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := openSource(path, stat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	if n := len(src.Names()); n != 2 {
+		t.Fatalf("len(Names()) = %d", n)
+	}
+	cfg, err := decodeImageConfig(src, "page0002")
+	if err != nil || cfg.Width != 800 || cfg.Height != 1000 {
+		t.Errorf("DecodeConfig = %v, %v", cfg, err)
+	}
+	if _, err := decodeImage(src, "page0001"); err != nil {
+		t.Errorf("DCTDecode: %v", err)
+	}
+	op := &Options{Row: 100, Head: 0, Tail: 1, Jobs: 1, NoRotate: true}
+	if res := testCheckDir(t, src, op); res.ISBN != "9784088725093" {
+		t.Errorf("ISBN = %q", res.ISBN)
+	}
+}
+
+//途中で切れたPDFはpanicせずエラーにする
+func TestTruncatedPDF(t *testing.T) {
+	data := testPDF(t, testCover(t), testCover(t, "9784088725093"))
+	for n := 0; n < len(data); n += 97 {
+		pdf, err := readPDF(data[:n])
+		if err != nil {
+			continue
+		}
+		for _, list := range pdf.pageImages() {
+			for _, stm := range list {
+				pdf.decodeImage(stm)
+			}
+		}
+	}
+	if _, err := readPDF([]byte("%PDF-1.4\n1 0 obj\n<< /A <")); err != nil {
+		t.Errorf("readPDF: %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "isbn2title")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "book.pdf")
+	if err := ioutil.WriteFile(path, data[:bytes.Index(data, []byte("5 0 obj"))+40], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if src, err := newPDFSource(path); err == nil {
+		src.Close()
+		t.Error("truncated PDF: no error")
+	}
+}
+
+//大きすぎる/Width,/Heightはintで溢れさせずエラーにする
+func TestHugePDFImage(t *testing.T) {
+	for _, dict := range []string{
+		"/Width 2147483647 /Height 2147483647 /ColorSpace /DeviceRGB",
+		"/Width 4611686018427387904 /Height 2 /ColorSpace /DeviceCMYK",
+		"/Width 1000000 /Height 1000000 /ColorSpace /DeviceGray",
+		"/Width 100 /Height 100 /ColorSpace [/ICCBased << /N 4611686018427387904 >>]",
+		"/Width 100 /Height 100 /ColorSpace /DeviceGray /DecodeParms << /Predictor 15 /Columns 4611686018427387904 /Colors 3 >>",
+	} {
+		var buf bytes.Buffer
+		buf.WriteString("%PDF-1.4\n")
+		fmt.Fprintf(&buf, "1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+		fmt.Fprintf(&buf, "2 0 obj\n<< /Type /Pages /Kids [3 0 R] /Count 1 >>\nendobj\n")
+		fmt.Fprintf(&buf, "3 0 obj\n<< /Type /Page /Parent 2 0 R /Resources << /XObject << /Im0 4 0 R >> >> >>\nendobj\n")
+		fmt.Fprintf(&buf, "4 0 obj\n<< /Type /XObject /Subtype /Image %s /BitsPerComponent 8 /Length 16 >>\nstream\n0123456789abcdef\nendstream\nendobj\n", dict)
+		buf.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+		pdf, err := readPDF(buf.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, list := range pdf.pageImages() {
+			for _, stm := range list {
+				if _, err := pdf.decodeImage(stm); err == nil {
+					t.Errorf("%s: decodeImage: no error", dict)
+				}
+				if _, err := pdf.decodeImageReduced(stm, 2); err == nil {
+					t.Errorf("%s: decodeImageReduced: no error", dict)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package scan
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+
+	"github.com/makiuchi-d/gozxing"
+)
+
+//二値化の前に行う画像処理 普通にスキャンして見つからない場合に使う
+type Preprocess struct {
+	levels  bool //コントラストを伸ばす
+	sharpen bool //アンシャープマスク
+	shrink  bool //大きな画像を縮小
+	global  bool //GlobalHistogramBinarizerで二値化
+}
+
+var errPreprocess = errors.New("-preprocessはgray,levels,sharpen,shrink,global,hybridを,区切りで指定してください")
+
+//gray,hybridだけのように普通のスキャンと変わらなければnil
+func ParsePreprocess(s string) (*Preprocess, error) {
+	p := &Preprocess{}
+	for _, v := range strings.Split(s, ",") {
+		switch strings.TrimSpace(strings.ToLower(v)) {
+		case "", "gray":
+			//輝度にするのは常に行う
+		case "levels":
+			p.levels = true
+		case "sharpen":
+			p.sharpen = true
+		case "shrink":
+			p.shrink = true
+		case "global":
+			p.global = true
+		case "hybrid":
+			p.global = false
+		default:
+			return nil, fmt.Errorf("%w: %s", errPreprocess, v)
+		}
+	}
+	if *p == (Preprocess{}) {
+		return nil, nil
+	}
+	return p, nil
+}
+
+func (p *Preprocess) String() string {
+	var list []string
+	if p.shrink {
+		list = append(list, "shrink")
+	}
+	if p.levels {
+		list = append(list, "levels")
+	}
+	if p.sharpen {
+		list = append(list, "sharpen")
+	}
+	if p.global {
+		list = append(list, "global")
+	} else {
+		list = append(list, "hybrid")
+	}
+	return strings.Join(list, ",")
+}
+
+//画像処理してグレースケールにする
+func (p *Preprocess) apply(img image.Image) *image.Gray {
+	var g *image.Gray
+	if p.shrink {
+		g = downscale(img, scanMaxSide)
+	}
+	if g == nil {
+		g = toGray(img)
+	}
+	if p.levels {
+		autoLevels(g)
+	}
+	if p.sharpen {
+		g = unsharpMask(g, 2, 1.0)
+	}
+	return g
+}
+
+func (p *Preprocess) binarizer() func(gozxing.LuminanceSource) gozxing.Binarizer {
+	if p != nil && p.global {
+		return gozxing.NewGlobalHistgramBinarizer
+	}
+	return gozxing.NewHybridBinarizer
+}
+
+//元の画像を変更しないようにコピーしたグレースケール画像
+func toGray(img image.Image) *image.Gray {
+	b := img.Bounds()
+	g := image.NewGray(image.Rect(0, 0, b.Dx(), b.Dy()))
+	switch src := img.(type) {
+	case *image.Gray:
+		for y := 0; y < b.Dy(); y++ {
+			i := (b.Min.Y+y-src.Rect.Min.Y)*src.Stride + b.Min.X - src.Rect.Min.X
+			copy(g.Pix[y*g.Stride:], src.Pix[i:i+b.Dx()])
+		}
+	case *image.YCbCr:
+		for y := 0; y < b.Dy(); y++ {
+			i := (b.Min.Y+y-src.Rect.Min.Y)*src.YStride + b.Min.X - src.Rect.Min.X
+			copy(g.Pix[y*g.Stride:], src.Y[i:i+b.Dx()])
+		}
+	default:
+		for y := 0; y < b.Dy(); y++ {
+			for x := 0; x < b.Dx(); x++ {
+				g.Pix[y*g.Stride+x] = color.GrayModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.Gray).Y
+			}
+		}
+	}
+	return g
+}
+
+//上下1%を除いた明るさの範囲を0-255に伸ばす 黄ばんだ紙や薄い印刷向け
+func autoLevels(g *image.Gray) {
+	var hist [256]int
+	for _, v := range g.Pix {
+		hist[v]++
+	}
+	cut := len(g.Pix) / 100
+	lo, hi := 0, 255
+	for n := 0; lo < 255 && n+hist[lo] <= cut; lo++ {
+		n += hist[lo]
+	}
+	for n := 0; hi > 0 && n+hist[hi] <= cut; hi-- {
+		n += hist[hi]
+	}
+	if hi <= lo {
+		return
+	}
+	var table [256]uint8
+	for i := range table {
+		v := (i - lo) * 255 / (hi - lo)
+		if v < 0 {
+			v = 0
+		} else if v > 255 {
+			v = 255
+		}
+		table[i] = uint8(v)
+	}
+	for i, v := range g.Pix {
+		g.Pix[i] = table[v]
+	}
+}
+
+//元画像とぼかした画像の差を足してエッジを強調する
+func unsharpMask(g *image.Gray, radius int, amount float64) *image.Gray {
+	w, h := g.Rect.Dx(), g.Rect.Dy()
+	blur := boxBlur(g, radius)
+	out := image.NewGray(g.Rect)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			o := float64(g.Pix[y*g.Stride+x])
+			b := float64(blur[y*w+x])
+			v := o + amount*(o-b)
+			if v < 0 {
+				v = 0
+			} else if v > 255 {
+				v = 255
+			}
+			out.Pix[y*out.Stride+x] = uint8(v)
+		}
+	}
+	return out
+}
+
+//横、縦の順に平均をとる
+func boxBlur(g *image.Gray, radius int) []uint8 {
+	w, h := g.Rect.Dx(), g.Rect.Dy()
+	tmp := make([]uint8, w*h)
+	out := make([]uint8, w*h)
+	for y := 0; y < h; y++ {
+		row := g.Pix[y*g.Stride : y*g.Stride+w]
+		for x := 0; x < w; x++ {
+			sum, n := 0, 0
+			for i := x - radius; i <= x+radius; i++ {
+				if i >= 0 && i < w {
+					sum += int(row[i])
+					n++
+				}
+			}
+			tmp[y*w+x] = uint8(sum / n)
+		}
+	}
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			sum, n := 0, 0
+			for i := y - radius; i <= y+radius; i++ {
+				if i >= 0 && i < h {
+					sum += int(tmp[i*w+x])
+					n++
+				}
+			}
+			out[y*w+x] = uint8(sum / n)
+		}
+	}
+	return out
+}
@@ -0,0 +1,61 @@
+package scan
+
+import (
+	"testing"
+)
+
+func TestParsePreprocess(t *testing.T) {
+	p, err := ParsePreprocess("gray,levels,sharpen,global")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.levels || !p.sharpen || p.shrink || !p.global {
+		t.Errorf("parsePreprocess = %+v", p)
+	}
+	for _, s := range []string{"", "gray", "hybrid", "gray,hybrid"} {
+		if p, err := ParsePreprocess(s); p != nil || err != nil {
+			t.Errorf("ParsePreprocess(%q) = %v, %v", s, p, err)
+		}
+	}
+	if _, err := ParsePreprocess("levels,blur"); err == nil {
+		t.Error("blur accepted")
+	}
+}
+
+func TestAutoLevels(t *testing.T) {
+	g := testCover(t, "9784088725093")
+	//黄ばんだ紙と薄い印刷
+	for i, v := range g.Pix {
+		g.Pix[i] = 150 + v/8
+	}
+	autoLevels(g)
+	min, max := uint8(255), uint8(0)
+	for _, v := range g.Pix {
+		if v < min {
+			min = v
+		}
+		if v > max {
+			max = v
+		}
+	}
+	if min != 0 || max != 255 {
+		t.Errorf("autoLevels range = %d-%d", min, max)
+	}
+}
+
+func TestPreprocessFallback(t *testing.T) {
+	g := testCover(t, "9784088725093")
+	//ぼやけた薄い印刷
+	blurred := boxBlur(g, 1)
+	for i := range g.Pix {
+		g.Pix[i] = 150 + blurred[i]/16
+	}
+	op := &Options{Row: 100, NoRotate: true}
+	if res := testScan(t, g, op); res.ISBN != "" {
+		t.Fatalf("画像処理なしで読めてしまう %q", res.ISBN)
+	}
+	op.Preprocess, _ = ParsePreprocess("levels,sharpen,global")
+	if res := testScan(t, g, op); res.ISBN != "9784088725093" {
+		t.Errorf("ISBN = %q", res.ISBN)
+	}
+}
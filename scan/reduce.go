@@ -0,0 +1,323 @@
+package scan
+
+import (
+	"bufio"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+)
+
+//読みながら縮小できない形式 元の大きさでデコードしてから縮小する
+var errNoReduce = errors.New("縮小しながらデコードできない形式です")
+
+//読みながら縮小できる読み込み元 PDFなど
+type reducedDecoder interface {
+	DecodeReduced(name string, f int) (image.Image, error)
+}
+
+//1行ずつ輝度を受け取ってf分の1に縮小する 端数の行と列は捨てる
+type shrinker struct {
+	f   int
+	dst *image.Gray
+	sum []int
+	y   int
+}
+
+func newShrinker(width, height, f int) *shrinker {
+	dst := image.NewGray(image.Rect(0, 0, width/f, height/f))
+	return &shrinker{f: f, dst: dst, sum: make([]int, width/f)}
+}
+
+//lumは元の画像の幅以上の1行分の輝度
+func (s *shrinker) row(lum []byte) {
+	dy := s.y / s.f
+	s.y++
+	if dy >= s.dst.Rect.Dy() {
+		return
+	}
+	for dx := range s.sum {
+		for _, v := range lum[dx*s.f : (dx+1)*s.f] {
+			s.sum[dx] += int(v)
+		}
+	}
+	if s.y%s.f != 0 {
+		return
+	}
+	area := s.f * s.f
+	line := s.dst.Pix[dy*s.dst.Stride:]
+	for dx, v := range s.sum {
+		line[dx] = uint8(v / area)
+		s.sum[dx] = 0
+	}
+}
+
+//画像を1/fに縮小しながらデコード 元の大きさの画像は作らない
+//baseline JPEG、PNG、TIFF、PDFの画像に対応し、それ以外はerrNoReduce
+func decodeReduced(src imageSource, name string, f int) (image.Image, error) {
+	if d, ok := src.(reducedDecoder); ok {
+		return d.DecodeReduced(name, f)
+	}
+	if _, ok := src.(imageDecoder); ok {
+		return nil, errNoReduce
+	}
+	if base, page := splitPage(name); isTIFF(base) {
+		return decodeTIFFPageReduced(src, base, page, f)
+	}
+	fh, err := src.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+	br := bufio.NewReader(fh)
+	magic, _ := br.Peek(8)
+	switch {
+	case len(magic) >= 2 && magic[0] == 0xFF && magic[1] == 0xD8:
+		//EXIFのOrientationを見るため一度全部読む
+		data, err := ioutil.ReadAll(br)
+		if err != nil {
+			return nil, err
+		}
+		img, err := decodeJPEGReduced(data, f)
+		if err != nil {
+			return nil, err
+		}
+		return applyOrientation(img, exifOrientation(data)), nil
+	case string(magic) == pngMagic:
+		return decodePNGReduced(br, f)
+	}
+	return nil, errNoReduce
+}
+
+//1行のサンプルの並び
+type rowFormat struct {
+	comps   int     //1:グレー 3:RGB 4:CMYK
+	bpc     int     //1,2,4,8,16 16はビッグエンディアン
+	palette []uint8 //インデックスごとの輝度 nilでなければcompsは1
+	invert  bool    //0を白にする
+}
+
+func (rf *rowFormat) stride(width int) int {
+	return (width*rf.comps*rf.bpc + 7) / 8
+}
+
+//1行のサンプルを輝度にする
+func (rf *rowFormat) lum(dst, row []byte) {
+	maxv := (1 << uint(rf.bpc)) - 1
+	raw := func(i int) int {
+		switch rf.bpc {
+		case 8:
+			return int(row[i])
+		case 16:
+			return int(row[i*2])
+		}
+		bit := i * rf.bpc
+		return int(row[bit/8]) >> uint(8-rf.bpc-bit%8) & maxv
+	}
+	sample := func(i int) uint8 {
+		if rf.bpc >= 8 {
+			return uint8(raw(i))
+		}
+		return uint8(raw(i) * 255 / maxv)
+	}
+	for x := range dst {
+		switch {
+		case rf.palette != nil:
+			idx := raw(x)
+			if idx >= len(rf.palette) {
+				idx = len(rf.palette) - 1
+			}
+			dst[x] = rf.palette[idx]
+		case rf.comps == 1:
+			dst[x] = sample(x)
+			if rf.invert {
+				dst[x] = 255 - dst[x]
+			}
+		case rf.comps == 3:
+			dst[x] = rgbGray(sample(x*3), sample(x*3+1), sample(x*3+2))
+		case rf.comps == 4:
+			r, g, b, _ := color.CMYK{sample(x * 4), sample(x*4 + 1), sample(x*4 + 2), sample(x*4 + 3)}.RGBA()
+			dst[x] = gray16(r, g, b)
+		}
+	}
+}
+
+//color.GrayModelと同じ輝度
+func rgbGray(r, g, b uint8) uint8 {
+	return gray16(uint32(r)*0x101, uint32(g)*0x101, uint32(b)*0x101)
+}
+
+func gray16(r, g, b uint32) uint8 {
+	return uint8((19595*r + 38470*g + 7471*b + 1<<15) >> 24)
+}
+
+//PNGのフィルタを1行戻す PDFのPNG Predictorと同じ
+func unfilterRow(ft byte, row, prev []byte, bpp int) {
+	for i := range row {
+		var a, b, c byte
+		if i >= bpp {
+			a = row[i-bpp]
+			c = prev[i-bpp]
+		}
+		b = prev[i]
+		switch ft {
+		case 1:
+			row[i] += a
+		case 2:
+			row[i] += b
+		case 3:
+			row[i] += byte((int(a) + int(b)) / 2)
+		case 4:
+			row[i] += paeth(a, b, c)
+		}
+	}
+}
+
+//r(1行ごとにフィルタの種類が付く形式ならfiltered)からheight行を読んで縮小する
+func shrinkRows(r io.Reader, rf *rowFormat, width, height, f int, filtered bool) (*image.Gray, error) {
+	stride := rf.stride(width)
+	bpp := (rf.comps*rf.bpc + 7) / 8
+	skip := 0
+	if filtered {
+		skip = 1
+	}
+	buf := make([]byte, skip+stride)
+	prev := make([]byte, stride)
+	lum := make([]byte, width)
+	s := newShrinker(width, height, f)
+	for y := 0; y < height; y++ {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		row := buf[skip:]
+		if filtered {
+			unfilterRow(buf[0], row, prev, bpp)
+		}
+		rf.lum(lum, row)
+		s.row(lum)
+		copy(prev, row)
+	}
+	return s.dst, nil
+}
+
+const pngMagic = "\x89PNG\r\n\x1a\n"
+
+//PNGをIDATを展開しながら1行ずつ縮小する インターレースと透明度のあるものはerrNoReduce
+func decodePNGReduced(r io.Reader, f int) (*image.Gray, error) {
+	var sig [8]byte
+	if _, err := io.ReadFull(r, sig[:]); err != nil {
+		return nil, err
+	}
+	if string(sig[:]) != pngMagic {
+		return nil, errNoReduce
+	}
+	var width, height int
+	var rf *rowFormat
+	for {
+		length, typ, err := pngChunk(r)
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case "IHDR":
+			if length != 13 {
+				return nil, errNoReduce
+			}
+			var h [13]byte
+			if _, err := io.ReadFull(r, h[:]); err != nil {
+				return nil, err
+			}
+			width, height = int(binary.BigEndian.Uint32(h[0:4])), int(binary.BigEndian.Uint32(h[4:8]))
+			if width <= 0 || height <= 0 || width > 1<<24 || height > 1<<24 || h[12] != 0 {
+				return nil, errNoReduce
+			}
+			rf = &rowFormat{comps: 1, bpc: int(h[8])}
+			low := rf.bpc == 1 || rf.bpc == 2 || rf.bpc == 4 || rf.bpc == 8
+			switch {
+			case h[9] == 0 && (low || rf.bpc == 16):
+			case h[9] == 2 && (rf.bpc == 8 || rf.bpc == 16):
+				rf.comps = 3
+			case h[9] == 3 && low:
+				rf.palette = []uint8{}
+			default:
+				return nil, errNoReduce
+			}
+		case "PLTE":
+			if rf == nil || length%3 != 0 || length > 768 {
+				return nil, errNoReduce
+			}
+			p := make([]byte, length)
+			if _, err := io.ReadFull(r, p); err != nil {
+				return nil, err
+			}
+			if rf.palette != nil {
+				for i := 0; i < len(p); i += 3 {
+					rf.palette = append(rf.palette, rgbGray(p[i], p[i+1], p[i+2]))
+				}
+			}
+		case "tRNS":
+			return nil, errNoReduce
+		case "IDAT":
+			if rf == nil || (rf.palette != nil && len(rf.palette) == 0) {
+				return nil, errNoReduce
+			}
+			zr, err := zlib.NewReader(&pngIDAT{r: r, left: length})
+			if err != nil {
+				return nil, err
+			}
+			defer zr.Close()
+			return shrinkRows(zr, rf, width, height, f, true)
+		default:
+			if _, err := io.CopyN(ioutil.Discard, r, int64(length)); err != nil {
+				return nil, err
+			}
+		}
+		//CRC
+		if _, err := io.CopyN(ioutil.Discard, r, 4); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func pngChunk(r io.Reader) (int, string, error) {
+	var h [8]byte
+	if _, err := io.ReadFull(r, h[:]); err != nil {
+		return 0, "", err
+	}
+	length := binary.BigEndian.Uint32(h[:4])
+	if length > 1<<31-1 {
+		return 0, "", errNoReduce
+	}
+	return int(length), string(h[4:]), nil
+}
+
+//続くIDATをつなげて読む
+type pngIDAT struct {
+	r    io.Reader
+	left int
+}
+
+func (d *pngIDAT) Read(p []byte) (int, error) {
+	for d.left == 0 {
+		if _, err := io.CopyN(ioutil.Discard, d.r, 4); err != nil {
+			return 0, err
+		}
+		length, typ, err := pngChunk(d.r)
+		if err != nil {
+			return 0, err
+		}
+		if typ != "IDAT" {
+			return 0, io.EOF
+		}
+		d.left = length
+	}
+	if len(p) > d.left {
+		p = p[:d.left]
+	}
+	n, err := d.r.Read(p)
+	d.left -= n
+	return n, err
+}
@@ -0,0 +1,203 @@
+package scan
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+)
+
+//バーコードと濃淡のある画像
+func testReduceImage(t *testing.T) (*image.Gray, *image.RGBA, *image.Paletted) {
+	g := testCover(t, "9784088725093")
+	rgba := image.NewRGBA(g.Rect)
+	pal := image.NewPaletted(g.Rect, color.Palette{color.Black, color.White, color.RGBA{200, 40, 40, 255}, color.RGBA{40, 40, 200, 255}})
+	for y := 0; y < g.Rect.Dy(); y++ {
+		for x := 0; x < g.Rect.Dx(); x++ {
+			v := g.GrayAt(x, y).Y
+			if v == 255 {
+				v = uint8(255 - y/8)
+				g.SetGray(x, y, color.Gray{v})
+			}
+			rgba.Set(x, y, color.RGBA{v, uint8(x / 4), 255 - v, 255})
+			pal.SetColorIndex(x, y, uint8(x/100%4))
+		}
+	}
+	return g, rgba, pal
+}
+
+func TestDecodeReduced(t *testing.T) {
+	dir, err := ioutil.TempDir("", "isbn2title")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	g, rgba, pal := testReduceImage(t)
+	files := map[string]int{} //ファイル名 => JPEGの誤差
+	write := func(name string, data []byte, tolerance int) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		files[name] = tolerance
+	}
+	for name, img := range map[string]image.Image{"gray": g, "rgb": rgba, "pal": pal} {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		write(name+".png", buf.Bytes(), 0)
+		if name != "pal" {
+			buf.Reset()
+			if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+				t.Fatal(err)
+			}
+			write(name+".jpg", buf.Bytes(), 2)
+		}
+	}
+	for name, opt := range map[string]*tiff.Options{
+		"none":    {Compression: tiff.Uncompressed},
+		"deflate": {Compression: tiff.Deflate, Predictor: true},
+	} {
+		for _, img := range []image.Image{g, pal} {
+			var buf bytes.Buffer
+			if err := tiff.Encode(&buf, img, opt); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := img.(*image.Paletted); ok {
+				name += "_pal"
+			}
+			write(name+".tif", buf.Bytes(), 0)
+		}
+	}
+	write("book.tif", testTIFF(image.NewGray(image.Rect(0, 0, 10, 10)), g), 0)
+
+	src, err := newDirSource(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files["book.tif#2"] = 0
+	for name, tolerance := range files {
+		if name == "book.tif" {
+			continue
+		}
+		full, err := decodeImage(src, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range []int{2, 4} {
+			img, err := decodeReduced(src, name, f)
+			if err != nil {
+				t.Errorf("%s: %v", name, err)
+				continue
+			}
+			want := downscale(full, 1000/f)
+			if d := maxDiff(toGray(img), want); d > tolerance {
+				t.Errorf("%s 1/%d: Bounds = %v, want %v, diff = %d", name, f, img.Bounds(), want.Bounds(), d)
+			}
+		}
+	}
+
+	//BMPは元の大きさでデコードする
+	var buf bytes.Buffer
+	if err := bmp.Encode(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+	write("gray.bmp", buf.Bytes(), 0)
+	if _, err := decodeReduced(src, "gray.bmp", 2); err != errNoReduce {
+		t.Errorf("bmp: err = %v, want errNoReduce", err)
+	}
+}
+
+func TestPDFReduced(t *testing.T) {
+	dir, err := ioutil.TempDir("", "isbn2title")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	g, _, _ := testReduceImage(t)
+	path := filepath.Join(dir, "book.pdf")
+	if err := ioutil.WriteFile(path, testPDF(t, g, g), 0644); err != nil {
+		t.Fatal(err)
+	}
+	src, err := newPDFSource(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	for name, tolerance := range map[string]int{"page0001": 2, "page0002": 0} {
+		full, err := decodeImage(src, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := decodeReduced(src, name, 2)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if d := maxDiff(toGray(img), downscale(full, 500)); d > tolerance {
+			t.Errorf("%s: diff = %d", name, d)
+		}
+	}
+}
+
+//縮小してもバーコードが読める
+func TestScanReduced(t *testing.T) {
+	dir, err := ioutil.TempDir("", "isbn2title")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var buf bytes.Buffer
+	big := image.NewGray(image.Rect(0, 0, 1600, 2000))
+	for i := range big.Pix {
+		big.Pix[i] = 255
+	}
+	cover := testCover(t, "9784088725093")
+	for y := 0; y < 2000; y++ {
+		for x := 0; x < 1600; x++ {
+			big.Pix[y*big.Stride+x] = cover.Pix[y/2*cover.Stride+x/2]
+		}
+	}
+	if err := jpeg.Encode(&buf, big, &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "001.jpg"), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	src, err := newDirSource(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	op := &Options{Row: 100, Head: 1, Jobs: 1, NoRotate: true, MaxPixels: 1000000}
+	img, err := decodeScanImage(src, "001.jpg", op)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 800 || b.Dy() != 1000 {
+		t.Errorf("Bounds = %v", b)
+	}
+	if res := testCheckDir(t, src, op); res.ISBN != "9784088725093" {
+		t.Errorf("ISBN = %q", res.ISBN)
+	}
+}
+
+func maxDiff(a, b *image.Gray) int {
+	if a.Rect != b.Rect {
+		return 256
+	}
+	d := 0
+	for i := range a.Pix {
+		if v := absInt(int(a.Pix[i]) - int(b.Pix[i])); v > d {
+			d = v
+		}
+	}
+	return d
+}
@@ -0,0 +1,75 @@
+package scan
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+)
+
+//最初にスキャンする範囲 幅と高さに対する割合
+type ROI struct {
+	x0, y0, x1, y1 float64
+}
+
+var roiPresets = map[string]ROI{
+	"top-right":    {0.5, 0, 1, 0.5},
+	"bottom-right": {0.5, 0.5, 1, 1},
+	"top-left":     {0, 0, 0.5, 0.5},
+	"bottom-left":  {0, 0.5, 0.5, 1},
+	"top":          {0, 0, 1, 0.5},
+	"bottom":       {0, 0.5, 1, 1},
+	"right":        {0.5, 0, 1, 1},
+	"left":         {0, 0, 0.5, 1},
+}
+
+var errROI = errors.New("-roiはtop-rightなどの名前か、x0,y0,x1,y1を0から1の割合で指定してください")
+
+func ParseROI(s string) (*ROI, error) {
+	s = strings.TrimSpace(strings.ToLower(s))
+	if s == "" {
+		return nil, nil
+	}
+	if r, ok := roiPresets[s]; ok {
+		return &r, nil
+	}
+	v := strings.Split(s, ",")
+	if len(v) != 4 {
+		return nil, fmt.Errorf("%w: %s", errROI, s)
+	}
+	var f [4]float64
+	for i := range v {
+		n, err := strconv.ParseFloat(strings.TrimSpace(v[i]), 64)
+		if err != nil || n < 0 || n > 1 {
+			return nil, fmt.Errorf("%w: %s", errROI, s)
+		}
+		f[i] = n
+	}
+	if f[0] >= f[2] || f[1] >= f[3] {
+		return nil, fmt.Errorf("%w: %s", errROI, s)
+	}
+	return &ROI{f[0], f[1], f[2], f[3]}, nil
+}
+
+func (r *ROI) rect(b image.Rectangle) image.Rectangle {
+	w, h := float64(b.Dx()), float64(b.Dy())
+	return image.Rect(
+		b.Min.X+int(r.x0*w), b.Min.Y+int(r.y0*h),
+		b.Min.X+int(r.x1*w+0.5), b.Min.Y+int(r.y1*h+0.5),
+	).Intersect(b)
+}
+
+//範囲を切り出した画像 全体と同じならnil
+func (r *ROI) crop(img image.Image) image.Image {
+	rect := r.rect(img.Bounds())
+	if rect.Empty() || rect == img.Bounds() {
+		return nil
+	}
+	if sub, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(rect)
+	}
+	return toGray(img).SubImage(rect.Sub(img.Bounds().Min))
+}
@@ -0,0 +1,37 @@
+package scan
+
+import (
+	"image"
+	"testing"
+)
+
+func TestParseROI(t *testing.T) {
+	r, err := ParseROI("top-right")
+	if err != nil || *r != (ROI{0.5, 0, 1, 0.5}) {
+		t.Errorf("parseROI(top-right) = %v, %v", r, err)
+	}
+	r, err = ParseROI("0.6, 0, 1, 0.3")
+	if err != nil || *r != (ROI{0.6, 0, 1, 0.3}) {
+		t.Errorf("parseROI = %v, %v", r, err)
+	}
+	for _, s := range []string{"middle", "0,0,1", "0.5,0,0.4,1", "0,0,2,1"} {
+		if _, err := ParseROI(s); err == nil {
+			t.Errorf("parseROI(%q) accepted", s)
+		}
+	}
+	if got := r.rect(image.Rect(0, 0, 1000, 2000)); got != image.Rect(600, 0, 1000, 600) {
+		t.Errorf("rect = %v", got)
+	}
+}
+
+func TestROIFallback(t *testing.T) {
+	img := testCover(t, "9784088725093", "1920979007000")
+	for _, spec := range []string{"top-right", "bottom-left"} {
+		op := &Options{Row: 100, NoRotate: true}
+		op.ROI, _ = ParseROI(spec)
+		res := testScan(t, img, op)
+		if res.ISBN != "9784088725093" || res.Code == nil {
+			t.Errorf("%s: ISBN = %q, Code = %v", spec, res.ISBN, res.Code)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package scan
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/makiuchi-d/gozxing"
+)
+
+//スキャンする向き
+type Pass struct {
+	rotate int     //反時計回り 0,90,180,270
+	skew   float64 //傾き補正の角度
+}
+
+//skewで試す角度 小さい順
+var skewAngles = []float64{5, -5, 10, -10, 15, -15}
+
+var defaultScanPasses = []Pass{{rotate: 0}, {rotate: 90}}
+
+var errRotations = errors.New("-rotationsは0,90,180,270,skewを,区切りで指定してください")
+
+//"0,90,180,270,skew" を解析 skewは指定した向きそれぞれの傾き補正を最後に試す
+func ParseRotations(s string) ([]Pass, error) {
+	var passes []Pass
+	skew := false
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(strings.ToLower(v))
+		switch v {
+		case "":
+			continue
+		case "skew":
+			skew = true
+			continue
+		}
+		deg, err := strconv.Atoi(v)
+		if err != nil || deg%90 != 0 || deg < 0 || deg >= 360 {
+			return nil, fmt.Errorf("%w: %s", errRotations, v)
+		}
+		passes = append(passes, Pass{rotate: deg})
+	}
+	if len(passes) == 0 {
+		passes = append(passes, Pass{rotate: 0})
+	}
+	if skew {
+		n := len(passes)
+		for _, angle := range skewAngles {
+			for _, p := range passes[:n] {
+				passes = append(passes, Pass{rotate: p.rotate, skew: angle})
+			}
+		}
+	}
+	return passes, nil
+}
+
+func (p Pass) String() string {
+	if p.skew != 0 {
+		return fmt.Sprintf("%d%+g", p.rotate, p.skew)
+	}
+	return strconv.Itoa(p.rotate)
+}
+
+//-noRotate,-rotations からスキャンする向きの一覧
+func (op *Options) scanPasses() []Pass {
+	if op.NoRotate {
+		return defaultScanPasses[:1]
+	}
+	if op.Passes != nil {
+		return op.Passes
+	}
+	return defaultScanPasses
+}
+
+//輝度を回転して傾きを補正する 二値化の前に行う
+func rotateLuminance(src gozxing.LuminanceSource, p Pass) (gozxing.LuminanceSource, error) {
+	var err error
+	for i := 0; i < p.rotate/90; i++ {
+		src, err = src.RotateCounterClockwise()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if p.skew == 0 {
+		return src, nil
+	}
+	return skewLuminance(src, p.skew)
+}
+
+//同じ大きさのまま中心で回転 はみ出た部分は白
+func skewLuminance(src gozxing.LuminanceSource, deg float64) (gozxing.LuminanceSource, error) {
+	w, h := src.GetWidth(), src.GetHeight()
+	in := src.GetMatrix()
+	out := make([]byte, w*h)
+	sin, cos := math.Sincos(deg * math.Pi / 180)
+	cx, cy := float64(w-1)/2, float64(h-1)/2
+	for y := 0; y < h; y++ {
+		dy := float64(y) - cy
+		for x := 0; x < w; x++ {
+			dx := float64(x) - cx
+			//出力座標から元の座標を求めてバイリニア補間
+			sx := cos*dx - sin*dy + cx
+			sy := sin*dx + cos*dy + cy
+			x0, y0 := int(math.Floor(sx)), int(math.Floor(sy))
+			if x0 < 0 || y0 < 0 || x0+1 >= w || y0+1 >= h {
+				out[y*w+x] = 255
+				continue
+			}
+			fx, fy := sx-float64(x0), sy-float64(y0)
+			i := y0*w + x0
+			top := float64(in[i])*(1-fx) + float64(in[i+1])*fx
+			bottom := float64(in[i+w])*(1-fx) + float64(in[i+w+1])*fx
+			out[y*w+x] = uint8(top*(1-fy) + bottom*fy + 0.5)
+		}
+	}
+	return gozxing.NewPlanarYUVLuminanceSource(out, w, h, 0, 0, w, h, false)
+}
@@ -0,0 +1,67 @@
+package scan
+
+import (
+	"image"
+	"math"
+	"testing"
+
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/oned"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/math/f64"
+)
+
+func TestParseRotations(t *testing.T) {
+	passes, err := ParseRotations("0,180,skew")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(passes) != 2+2*len(skewAngles) || passes[1].rotate != 180 || passes[2].skew != skewAngles[0] {
+		t.Errorf("parseRotations = %v", passes)
+	}
+	if _, err := ParseRotations("0,45"); err == nil {
+		t.Error("45 accepted")
+	}
+}
+
+//中心で回転した画像
+func rotatedCover(t *testing.T, src *image.Gray, deg float64) image.Image {
+	b := src.Bounds()
+	dst := image.NewGray(b)
+	for i := range dst.Pix {
+		dst.Pix[i] = 255
+	}
+	sin, cos := math.Sincos(deg * math.Pi / 180)
+	cx, cy := float64(b.Dx())/2, float64(b.Dy())/2
+	m := f64.Aff3{cos, -sin, cx - cos*cx + sin*cy, sin, cos, cy - sin*cx - cos*cy}
+	draw.BiLinear.Transform(dst, m, src, b, draw.Over, nil)
+	return dst
+}
+
+func TestSkewPass(t *testing.T) {
+	//背の低いバーコードは少しの傾きで読めなくなる
+	src := testCover(t)
+	bar, err := oned.NewEAN13Writer().Encode("9784088725093", gozxing.BarcodeFormat_EAN_13, 300, 30, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	draw.Draw(src, bar.Bounds().Add(image.Pt(250, 400)), bar, image.Point{}, draw.Src)
+	img := rotatedCover(t, src, 12)
+	op := &Options{Row: 100, Passes: []Pass{{rotate: 0}}}
+	if res := testScan(t, img, op); res.ISBN != "" {
+		t.Fatalf("傾いたまま読めてしまう %q", res.ISBN)
+	}
+	op.Passes, _ = ParseRotations("0,skew")
+	if res := testScan(t, img, op); res.ISBN != "9784088725093" {
+		t.Errorf("ISBN = %q", res.ISBN)
+	}
+}
+
+func TestRotate270(t *testing.T) {
+	img := rotatedCover(t, testCover(t, "9784088725093"), 90)
+	op := &Options{Row: 100}
+	op.Passes, _ = ParseRotations("0,180,270")
+	if res := testScan(t, img, op); res.ISBN != "9784088725093" {
+		t.Errorf("ISBN = %q", res.ISBN)
+	}
+}
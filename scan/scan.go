@@ -0,0 +1,498 @@
+//Package scan 画像、フォルダ、zip,cbz,pdfからISBNバーコードをスキャンする
+package scan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"os"
+	"reflect"
+	"strconv"
+	"sync"
+
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/oned"
+
+	"github.com/y9o/isbn2title/isbn"
+)
+
+//スキャンの設定 ゼロ値はそれぞれの初期値
+type Options struct {
+	Row        int         //rowで画像を上下に分割する数 初期値100
+	Head       int         //先頭からスキャンする画像の数 Options全体がゼロ値なら5
+	Tail       int         //最後尾からスキャンする画像の数 Options全体がゼロ値なら5
+	Jobs       int         //同時にスキャンする画像の数 初期値1
+	Strategy   string      //row,window
+	NoRotate   bool        //回転しない Passesより優先
+	Passes     []Pass      //ParseRotations 初期値は0,90
+	Preprocess *Preprocess //ParsePreprocess 見つからない場合の画像処理
+	ROI        *ROI        //ParseROI 最初にスキャンする範囲
+	Filter     *NameFilter //NewNameFilter
+	MinSize    int         //長辺がこれより小さい画像は数えない
+	MaxPixels  int         //画素数がこれより多い画像は縮小する
+	Confirm    int         //同じISBNが読めた範囲の数がこれ未満なら確度が低い 初期値1
+	Exhaustive bool        //見つかった後もスキャンを続け、すべてのISBNを返す
+	Debug      *DebugDump  //NewDebugDump
+	Cache      *Cache      //LoadCache
+	Rescan     bool        //Cacheを読まない
+	Metadata   []string    //ParseMetadata スキャンする前にISBNを探すメタデータの順番
+	Harvest    bool        //メタデータの次にテキストファイルに書かれたISBNを探す
+	Logger     *log.Logger //進み具合の出力先 nilなら出力しない
+}
+
+//スキャン結果
+type Result struct {
+	ISBN          isbn.ISBN
+	Code          *isbn.BookCode
+	Votes         int      //同じISBNが読めた範囲の数
+	LowConfidence bool     //Confirmに足りない
+	File          string   `json:",omitempty"` //見つかった画像
+	Files         []string `json:",omitempty"` //Exhaustiveで見つかったすべての画像
+}
+
+func (op *Options) logf(format string, v ...interface{}) {
+	if op.Logger != nil {
+		op.Logger.Printf(format, v...)
+	}
+}
+
+//画像をスキャン 見つからなければ空
+//Exhaustiveでなければ1つだけ、ExhaustiveならすべてのISBNを読めた範囲の数とともに返す
+func ScanImage(ctx context.Context, img image.Image, opts Options) ([]Result, error) {
+	op := &opts
+	if op.Exhaustive {
+		hits, err := collectFromImage(ctx, img, op)
+		if err != nil {
+			return nil, err
+		}
+		return resultsFromHits(hits, op), nil
+	}
+	res, err := getISBNfromImage(op.Debug.scan(ctx, "image"), img, op)
+	if err != nil || res.ISBN == "" {
+		return nil, err
+	}
+	return []Result{res}, nil
+}
+
+//フォルダ、またはzip,cbz,pdfファイルの画像をHead,Tailの優先順にスキャン
+//Exhaustiveでなければメタデータ、テキストファイル、なければ最も優先順の高い1つ、Exhaustiveなら見つかったすべてのISBNを返す
+func ScanDir(ctx context.Context, path string, opts Options) ([]Result, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	src, err := openSource(path, stat)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	//Options{}なら先頭、最後尾から5つずつ Head,Tailを0にしたものは画像をスキャンしない
+	if reflect.DeepEqual(opts, Options{}) {
+		opts.Head, opts.Tail = 5, 5
+	}
+	op := &opts
+	if op.Exhaustive {
+		hits, err := checkDirAll(ctx, src, op)
+		if err != nil {
+			return nil, err
+		}
+		return resultsFromHits(hits, op), nil
+	}
+	if res := probeMetadata(src, op); res.ISBN != "" {
+		return []Result{res}, nil
+	}
+	if res := probeHarvest(src, op); res.ISBN != "" {
+		return []Result{res}, nil
+	}
+	res, err := checkDir(ctx, src, op)
+	if err != nil || res.ISBN == "" {
+		return nil, err
+	}
+	return []Result{res}, nil
+}
+
+//フォルダ、ZIP内からファイルリストを作成
+func checkDir(ctx context.Context, src imageSource, op *Options) (Result, error) {
+	return checkFiles(ctx, src, scanList(src, op), op)
+}
+
+//スキャンする画像を優先順に並べる
+func scanList(src imageSource, op *Options) []string {
+	names := candidateNames(src, op.Filter)
+
+	//先頭からHead個、最後尾からTail個の画像を優先順に並べる
+	//複数ページのTIFFは1ページずつ数える
+	var list []string
+	used := map[string]bool{}
+	n := 0
+	for i := 0; i < len(names) && n < op.Head; i++ {
+		for _, page := range imagePages(src, names[i], op) {
+			if n >= op.Head {
+				break
+			}
+			used[page] = true
+			list = append(list, page)
+			n++
+		}
+	}
+	n = 0
+	for i := len(names) - 1; i >= 0 && n < op.Tail; i-- {
+		pages := imagePages(src, names[i], op)
+		for j := len(pages) - 1; j >= 0 && n < op.Tail; j-- {
+			if !used[pages[j]] {
+				list = append(list, pages[j])
+			}
+			n++
+		}
+	}
+	return list
+}
+
+//画像ファイルならページごとの名前 ヘッダのみ読み込む
+//サムネイルのような小さな画像は数えない
+func imagePages(src imageSource, name string, op *Options) []string {
+	cfg, err := decodeImageConfig(src, name)
+	if err != nil || op.tooSmall(cfg) {
+		return nil
+	}
+	pages := []string{name}
+	if _, ok := src.(imageDecoder); ok || !isTIFF(name) {
+		return pages
+	}
+	count, err := countTIFFPages(src, name)
+	if err != nil {
+		return pages
+	}
+	for i := 2; i <= count; i++ {
+		pages = append(pages, name+"#"+strconv.Itoa(i))
+	}
+	return pages
+}
+
+//ファイルリストの画像を並列にスキャン
+//見つかった時点で後ろの画像は中断し、リストの前にある画像の結果を優先する
+func checkFiles(parent context.Context, src imageSource, names []string, op *Options) (Result, error) {
+	if len(names) == 0 {
+		return Result{}, nil
+	}
+	jobs := op.Jobs
+	if jobs < 1 {
+		jobs = 1
+	}
+	if jobs > len(names) {
+		jobs = len(names)
+	}
+
+	ctx, cancel := context.WithCancel(parent)
+	jobCtx := make([]context.Context, len(names))
+	jobCancel := make([]context.CancelFunc, len(names))
+	for i := range names {
+		jobCtx[i], jobCancel[i] = context.WithCancel(ctx)
+	}
+	type scanDone struct {
+		seq int
+		res Result
+		err error
+	}
+	queue := make(chan int)
+	results := make(chan scanDone, len(names))
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+
+	go func() {
+		defer close(queue)
+		for i := range names {
+			select {
+			case queue <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				var d scanDone
+				d.seq = i
+				if jobCtx[i].Err() == nil {
+					d.res, d.err = scanFileCached(jobCtx[i], src, names[i], op)
+				}
+				results <- d
+			}
+		}()
+	}
+
+	done := make([]bool, len(names))
+	found := make([]Result, len(names))
+	next := 0
+	for range names {
+		var d scanDone
+		select {
+		case d = <-results:
+		case <-parent.Done():
+			return Result{}, parent.Err()
+		}
+		if d.err != nil {
+			return Result{}, d.err
+		}
+		done[d.seq] = true
+		found[d.seq] = d.res
+		if d.res.confirmed() {
+			//優先度の低い画像はもう必要ない
+			for j := d.seq + 1; j < len(names); j++ {
+				jobCancel[j]()
+			}
+		}
+		for next < len(names) && done[next] {
+			if found[next].confirmed() {
+				return found[next], nil
+			}
+			next++
+		}
+	}
+	//確度の低い結果しかなければ優先順で最初のもの
+	for _, res := range found {
+		if res.ISBN != "" {
+			return res, nil
+		}
+	}
+	return Result{}, nil
+}
+
+//キャッシュに同じ画像と設定の結果があればスキャンしない
+//Debugの場合は記録のために必ずスキャンする
+func scanFileCached(ctx context.Context, src imageSource, name string, op *Options) (Result, error) {
+	key := op.Cache.key(src, name, op)
+	if !op.Rescan && op.Debug == nil {
+		if res, ok := op.Cache.get(key); ok {
+			op.logf("Cache: %s\n", name)
+			return res, nil
+		}
+	}
+	res, err := scanFile(ctx, src, name, op)
+	//中断した結果は残さない
+	if err == nil && ctx.Err() == nil {
+		op.Cache.put(key, res)
+	}
+	return res, err
+}
+
+//画像ファイルを読み込んでスキャン 画像でないファイルは見つからなかったことにする
+func scanFile(ctx context.Context, src imageSource, name string, op *Options) (Result, error) {
+	img, err := decodeScanImage(src, name, op)
+	if err != nil {
+		if !errors.Is(err, image.ErrFormat) {
+			op.logf("%s: %s\n", name, err)
+		}
+		return Result{}, nil
+	}
+	op.logf("Scan: %s\n", name)
+	res, err := getISBNfromImage(op.Debug.scan(ctx, name), img, op)
+	if res.ISBN != "" {
+		res.File = name
+	}
+	return res, err
+}
+
+//ROIの範囲を先にスキャンして、見つからなければ画像全体
+func getISBNfromImage(ctx context.Context, img image.Image, op *Options) (Result, error) {
+	if op.ROI != nil {
+		if sub := op.ROI.crop(img); sub != nil {
+			res, err := scanImage(debugStage(ctx, "roi"), sub, op)
+			if err != nil || res.confirmed() || ctx.Err() != nil {
+				return res, err
+			}
+			all, err := scanImage(ctx, img, op)
+			return betterResult(res, all), err
+		}
+	}
+	return scanImage(ctx, img, op)
+}
+
+//大きな画像は縮小した画像を先にスキャン 見つからなければ画像処理してもう一度
+func scanImage(ctx context.Context, img image.Image, op *Options) (Result, error) {
+	var res Result
+	if op.Strategy == strategyWindow {
+		if small := downscale(img, scanMaxSide); small != nil {
+			var err error
+			res, err = getISBNfromImageOnce(debugStage(ctx, "small"), small, gozxing.NewHybridBinarizer, op)
+			if err != nil || res.confirmed() {
+				return res, err
+			}
+		}
+	}
+	full, err := getISBNfromImageOnce(debugStage(ctx, "full"), img, gozxing.NewHybridBinarizer, op)
+	res = betterResult(res, full)
+	if err != nil || res.confirmed() || op.Preprocess == nil || ctx.Err() != nil {
+		return res, err
+	}
+	pre, err := getISBNfromImageOnce(debugStage(ctx, "preprocess"), op.Preprocess.apply(img), op.Preprocess.binarizer(), op)
+	return betterResult(res, pre), err
+}
+
+//画僧をスキャンして、見つからなければ回転、傾きを補正してもう一度スキャン
+func getISBNfromImageOnce(ctx context.Context, img image.Image, binarizer func(gozxing.LuminanceSource) gozxing.Binarizer, op *Options) (Result, error) {
+	src := gozxing.NewLuminanceSourceFromImage(img)
+	var low Result
+	votes := map[isbn.ISBN]int{}
+	for _, pass := range op.scanPasses() {
+		if ctx.Err() != nil {
+			break
+		}
+		bmp, lum, err := passBitmap(src, pass, binarizer)
+		if err != nil {
+			return Result{}, err
+		}
+		pctx, dbg := debugBegin(ctx, pass, lum)
+		res, err := getISBNfromBmp(pctx, bmp, op)
+		dbg.finish()
+		if err != nil {
+			return Result{}, err
+		}
+		if res.ISBN == "" {
+			continue
+		}
+		if res.confirmed() {
+			return res, nil
+		}
+		//別の向きで同じ値が読めれば合わせて数える
+		votes[res.ISBN] += res.Votes
+		res.Votes = votes[res.ISBN]
+		if res.Votes >= op.confirmCount() {
+			res.LowConfidence = false
+			return res, nil
+		}
+		low = betterResult(low, res)
+	}
+	return low, nil
+}
+
+//向きを変えて二値化する
+func passBitmap(src gozxing.LuminanceSource, pass Pass, binarizer func(gozxing.LuminanceSource) gozxing.Binarizer) (*gozxing.BinaryBitmap, gozxing.LuminanceSource, error) {
+	lum, err := rotateLuminance(src, pass)
+	if err != nil {
+		return nil, nil, fmt.Errorf("rotate %s: %w", pass, err)
+	}
+	bmp, err := gozxing.NewBinaryBitmap(binarizer(lum))
+	if err != nil {
+		return nil, nil, err
+	}
+	return bmp, lum, nil
+}
+
+//Confirmを満たしたISBNか
+func (res Result) confirmed() bool {
+	return res.ISBN != "" && !res.LowConfidence
+}
+
+//確認済みの結果、なければ読めた範囲が多い結果
+func betterResult(a, b Result) Result {
+	if a.confirmed() {
+		return a
+	}
+	if b.confirmed() || b.Votes > a.Votes {
+		return b
+	}
+	return a
+}
+
+//Confirm 1未満は1
+func (op *Options) confirmCount() int {
+	if op.Confirm < 1 {
+		return 1
+	}
+	return op.Confirm
+}
+
+//Row 1未満は100
+func (op *Options) rowCount() int {
+	if op.Row < 1 {
+		return 100
+	}
+	return op.Row
+}
+
+//分割する範囲
+func (op *Options) cropRects(width, height int) []image.Rectangle {
+	if op.Strategy == strategyWindow {
+		return windowRects(width, height)
+	}
+	return rowRects(width, height, op.rowCount())
+}
+
+//画像をスキャン バーコードが2つあるので、画像を細かく区切って上から検索する必要がある
+//ISBNの下にある2段目(192)も続けて探す
+func getISBNfromBmp(ctx context.Context, bmp *gozxing.BinaryBitmap, op *Options) (Result, error) {
+	height := bmp.GetHeight()
+	width := bmp.GetWidth()
+	rects := op.cropRects(width, height)
+
+	//EAN13Readerは並列に使えないので毎回作成
+	scanner := oned.NewEAN13Reader()
+	var res Result
+	//ISBNが見つかった後に2段目を探す範囲
+	var band image.Rectangle
+	//Confirmに達するまで読めた範囲を数える
+	votes := map[isbn.ISBN]int{}
+	var best isbn.ISBN
+	dbg := debugFrom(ctx)
+	for _, r := range rects {
+		if ctx.Err() != nil {
+			return Result{}, nil
+		}
+		if res.ISBN != "" && (r.Min.Y < band.Min.Y || r.Min.Y > band.Max.Y) {
+			continue
+		}
+		//分割
+		newBmp, err := bmp.Crop(r.Min.X, r.Min.Y, r.Dx(), r.Dy())
+		if err != nil {
+			return Result{}, fmt.Errorf("bmp.Crop(%d,%d,%d,%d): %w", r.Min.X, r.Min.Y, r.Dx(), r.Dy(), err)
+		}
+		//バーコードを探す
+		result, err := scanner.DecodeWithoutHints(newBmp)
+		if err != nil {
+			dbg.attempt(r, newBmp, "", err)
+			continue
+		}
+		txt := result.GetText()
+		dbg.attempt(r, newBmp, txt, nil)
+		//ISBNは978,979で始まる 誤読はチェックディジットで弾いて次の候補へ
+		if res.ISBN == "" {
+			if id, err := isbn.Parse(txt); err == nil {
+				votes[id]++
+				if votes[id] > votes[best] {
+					best = id
+				}
+				if votes[id] < op.confirmCount() {
+					continue
+				}
+				res.ISBN = id
+				res.Votes = votes[id]
+				if res.Code != nil {
+					break
+				}
+				band = image.Rect(0, r.Min.Y, width, r.Max.Y+height/4)
+				continue
+			}
+		}
+		if res.Code == nil {
+			if code, err := isbn.ParseBookCode(txt); err == nil {
+				res.Code = code
+				if res.ISBN != "" {
+					break
+				}
+			}
+		}
+	}
+	if res.ISBN == "" && best != "" {
+		res.ISBN = best
+		res.Votes = votes[best]
+		res.LowConfidence = true
+	}
+	return res, nil
+}
@@ -0,0 +1,190 @@
+package scan
+
+import (
+	"archive/zip"
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/oned"
+)
+
+//裏表紙を模した画像 右上にISBNと2段目のバーコードを配置する
+func testCover(t testing.TB, codes ...string) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, 800, 1000))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	top := 60
+	for _, code := range codes {
+		bar, err := oned.NewEAN13Writer().Encode(code, gozxing.BarcodeFormat_EAN_13, 300, 90, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := bar.Bounds().Add(image.Pt(440, top))
+		draw.Draw(img, r, bar, image.Point{}, draw.Src)
+		top += 120
+	}
+	return img
+}
+
+func writeTestImage(t testing.TB, path string, img image.Image) {
+	fh, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+	if err := png.Encode(fh, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testCheckDir(t testing.TB, src imageSource, op *Options) Result {
+	res, err := checkDir(context.Background(), src, op)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func testScan(t testing.TB, img image.Image, op *Options) Result {
+	res, err := getISBNfromImage(context.Background(), img, op)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestScanImage(t *testing.T) {
+	list, err := ScanImage(context.Background(), testCover(t, "9784088725093", "1920979007000"), Options{})
+	if err != nil || len(list) != 1 {
+		t.Fatalf("ScanImage = %v, %v", list, err)
+	}
+	res := list[0]
+	if res.ISBN != "9784088725093" {
+		t.Fatalf("ISBN = %q", res.ISBN)
+	}
+	if res.Code == nil || res.Code.CCode != "C0979" || res.Code.Price != 700 {
+		t.Errorf("Code = %v", res.Code)
+	}
+}
+
+func TestCheckDirPriority(t *testing.T) {
+	dir, err := ioutil.TempDir("", "isbn2title")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	blank := testCover(t)
+	writeTestImage(t, filepath.Join(dir, "001.png"), testCover(t, "9784088725093"))
+	writeTestImage(t, filepath.Join(dir, "002.png"), blank)
+	writeTestImage(t, filepath.Join(dir, "003.png"), blank)
+	writeTestImage(t, filepath.Join(dir, "004.png"), testCover(t, "9780804429573"))
+	if err := ioutil.WriteFile(filepath.Join(dir, "000.txt"), []byte("memo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := newDirSource(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, jobs := range []int{1, 4} {
+		op := &Options{Row: 100, Head: 2, Tail: 2, Jobs: jobs, NoRotate: true}
+		if res := testCheckDir(t, src, op); res.ISBN != "9784088725093" {
+			t.Errorf("jobs=%d: ISBN = %q", jobs, res.ISBN)
+		}
+	}
+}
+
+func TestZipSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "isbn2title")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "book.cbz")
+	fh, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(fh)
+	for _, name := range []string{"book/10.png", "book/2.png", "book/1.png"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img := testCover(t)
+		if name == "book/10.png" {
+			img = testCover(t, "9784088725093")
+		}
+		if err := png.Encode(w, img); err != nil {
+			t.Fatal(err)
+		}
+	}
+	zw.Close()
+	fh.Close()
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := openSource(path, stat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	if got := strings.Join(src.Names(), ","); got != "book/1.png,book/2.png,book/10.png" {
+		t.Errorf("Names() = %s", got)
+	}
+	op := &Options{Row: 100, Head: 0, Tail: 1, Jobs: 2, NoRotate: true}
+	if res := testCheckDir(t, src, op); res.ISBN != "9784088725093" {
+		t.Errorf("ISBN = %q", res.ISBN)
+	}
+}
+
+func TestConfirm(t *testing.T) {
+	//縦に短いバーコードは1,2本の範囲でしか読めない
+	short := image.NewGray(image.Rect(0, 0, 800, 1000))
+	draw.Draw(short, short.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	bar, err := oned.NewEAN13Writer().Encode("9784088725093", gozxing.BarcodeFormat_EAN_13, 300, 12, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	draw.Draw(short, bar.Bounds().Add(image.Pt(440, 60)), bar, image.Point{}, draw.Src)
+
+	op := &Options{Row: 100, NoRotate: true, Confirm: 5}
+	if res := testScan(t, testCover(t, "9784088725093"), op); !res.confirmed() || res.Votes < 5 {
+		t.Errorf("tall: %+v", res)
+	}
+	res := testScan(t, short, op)
+	if res.ISBN != "9784088725093" || !res.LowConfidence {
+		t.Errorf("short: %+v", res)
+	}
+	op.Confirm = 1
+	if res := testScan(t, short, op); !res.confirmed() {
+		t.Errorf("confirm=1: %+v", res)
+	}
+}
+
+//ゼロ値のOptionsでも先頭、最後尾から5つずつスキャンする
+func TestZeroOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "isbn2title")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeTestImage(t, filepath.Join(dir, "1.png"), testCover(t))
+	writeTestImage(t, filepath.Join(dir, "2.png"), testCover(t, "9784088725093"))
+	list, err := ScanDir(context.Background(), dir, Options{})
+	if err != nil || len(list) != 1 || list[0].ISBN != "9784088725093" {
+		t.Errorf("ScanDir = %v, %v", list, err)
+	}
+}
@@ -0,0 +1,53 @@
+package scan
+
+import (
+	"image"
+	"math"
+)
+
+//読みながら縮小できない大きな画像のデコードは同時に1つまで 縮小前の画像でメモリを使い切らないように
+var largeDecode = make(chan struct{}, 1)
+
+//-minSizeより長辺が小さい画像はサムネイルとして除く
+func (op *Options) tooSmall(cfg image.Config) bool {
+	return op.MinSize > 0 && cfg.Width < op.MinSize && cfg.Height < op.MinSize
+}
+
+//-maxPixelsを超える画像を何分の1に縮小するか 超えなければ1
+func (op *Options) reduceFactor(cfg image.Config) int {
+	if op.MaxPixels <= 0 || cfg.Width*cfg.Height <= op.MaxPixels {
+		return 1
+	}
+	return int(math.Ceil(math.Sqrt(float64(cfg.Width) * float64(cfg.Height) / float64(op.MaxPixels))))
+}
+
+//スキャン用に画像をデコード -maxPixelsを超える画像は縮小する
+//JPEG、PNG、TIFF、PDFの多くは読みながら縮小し、元の大きさの画像を作らない
+//それ以外は元の大きさでデコードしてから縮小する
+func decodeScanImage(src imageSource, name string, op *Options) (image.Image, error) {
+	cfg, err := decodeImageConfig(src, name)
+	if err != nil {
+		return nil, err
+	}
+	f := op.reduceFactor(cfg)
+	if f == 1 {
+		return decodeImage(src, name)
+	}
+	if img, err := decodeReduced(src, name, f); err != errNoReduce {
+		return img, err
+	}
+	largeDecode <- struct{}{}
+	defer func() { <-largeDecode }()
+	img, err := decodeImage(src, name)
+	if err != nil {
+		return nil, err
+	}
+	long := cfg.Width
+	if cfg.Height > long {
+		long = cfg.Height
+	}
+	if small := downscale(img, long/f); small != nil {
+		return small, nil
+	}
+	return img, nil
+}
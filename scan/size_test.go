@@ -0,0 +1,45 @@
+package scan
+
+import (
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSizeLimit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "isbn2title")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeTestImage(t, filepath.Join(dir, "001.png"), image.NewGray(image.Rect(0, 0, 200, 150)))
+	writeTestImage(t, filepath.Join(dir, "002.png"), testCover(t, "9784088725093"))
+	src, err := newDirSource(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	op := &Options{Row: 100, Head: 1, Jobs: 1, NoRotate: true, MinSize: 300}
+	if pages := imagePages(src, "001.png", op); pages != nil {
+		t.Errorf("thumbnail: %v", pages)
+	}
+	//サムネイルは-headに数えない
+	if res := testCheckDir(t, src, op); res.ISBN != "9784088725093" {
+		t.Errorf("ISBN = %q", res.ISBN)
+	}
+
+	if img, _ := decodeScanImage(src, "002.png", op); img.Bounds().Dx() != 800 {
+		t.Errorf("maxPixels=0: Bounds = %v", img.Bounds())
+	}
+	op.MaxPixels = 200000
+	img, err := decodeScanImage(src, "002.png", op)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx()*b.Dy() > op.MaxPixels {
+		t.Errorf("Bounds = %v", b)
+	}
+}
@@ -0,0 +1,310 @@
+package scan
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/webp"
+)
+
+//スキャンする画像の読み込み元 フォルダやZIPファイル
+type imageSource interface {
+	//ファイル名の一覧 先頭から順にスキャンする
+	Names() []string
+	Open(name string) (io.ReadCloser, error)
+	Close() error
+}
+
+//Openで画像ファイルの形式で読み出せない読み込み元 PDFなど
+type imageDecoder interface {
+	Decode(name string) (image.Image, error)
+	DecodeConfig(name string) (image.Config, error)
+}
+
+var ErrUnknownSource = errors.New("対象フォルダ、またはzip,cbz,pdfファイルを指定してください")
+
+//パスに合った読み込み元を開く
+func openSource(path string, stat os.FileInfo) (imageSource, error) {
+	if stat.IsDir() {
+		return newDirSource(path)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".zip", ".cbz":
+		return newZipSource(path)
+	case ".pdf":
+		return newPDFSource(path)
+	}
+	return nil, ErrUnknownSource
+}
+
+//フォルダの代わりに指定できるファイルか
+func IsSourceFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".zip", ".cbz", ".pdf":
+		return true
+	}
+	return false
+}
+
+//読み込み元から画像をデコード
+func decodeImage(src imageSource, name string) (image.Image, error) {
+	if d, ok := src.(imageDecoder); ok {
+		return d.Decode(name)
+	}
+	if base, page := splitPage(name); page > 1 {
+		return decodeTIFFPage(src, base, page)
+	}
+	fh, err := src.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+	if isJPEG(name) {
+		//EXIFのOrientationを見るため一度全部読む
+		data, err := ioutil.ReadAll(fh)
+		if err != nil {
+			return nil, err
+		}
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return applyOrientation(img, exifOrientation(data)), nil
+	}
+	img, _, err := image.Decode(fh)
+	return img, err
+}
+
+func isJPEG(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".jpg", ".jpeg":
+		return true
+	}
+	return false
+}
+
+//読み込み元から画像のサイズだけ読む
+func decodeImageConfig(src imageSource, name string) (image.Config, error) {
+	if d, ok := src.(imageDecoder); ok {
+		return d.DecodeConfig(name)
+	}
+	if base, page := splitPage(name); page > 1 {
+		return decodeTIFFPageConfig(src, base, page)
+	}
+	fh, err := src.Open(name)
+	if err != nil {
+		return image.Config{}, err
+	}
+	defer fh.Close()
+	cfg, _, err := image.DecodeConfig(fh)
+	return cfg, err
+}
+
+type dirSource struct {
+	dir   string
+	names []string
+}
+
+func newDirSource(dir string) (*dirSource, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	src := &dirSource{dir: dir}
+	for _, file := range files {
+		if !file.IsDir() {
+			src.names = append(src.names, file.Name())
+		}
+	}
+	sort.SliceStable(src.names, func(i, j int) bool {
+		return naturalLess(src.names[i], src.names[j])
+	})
+	return src, nil
+}
+
+func (src *dirSource) Names() []string {
+	return src.names
+}
+func (src *dirSource) Open(name string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(src.dir, name))
+}
+func (src *dirSource) Close() error {
+	return nil
+}
+
+type zipSource struct {
+	zr    *zip.ReadCloser
+	files map[string]*zip.File
+	names []string
+}
+
+//ZIPのエントリを自然順に並べる 展開はしない
+func newZipSource(path string) (*zipSource, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	src := &zipSource{zr: zr, files: map[string]*zip.File{}}
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		src.files[f.Name] = f
+		src.names = append(src.names, f.Name)
+	}
+	sort.SliceStable(src.names, func(i, j int) bool {
+		return naturalLess(src.names[i], src.names[j])
+	})
+	return src, nil
+}
+
+func (src *zipSource) Names() []string {
+	return src.names
+}
+func (src *zipSource) Open(name string) (io.ReadCloser, error) {
+	f, ok := src.files[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return f.Open()
+}
+func (src *zipSource) Close() error {
+	return src.zr.Close()
+}
+
+//画像の拡張子 デコードする前にこれ以外を除く
+var imageExts = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".bmp":  true,
+	".webp": true,
+	".tif":  true,
+	".tiff": true,
+}
+
+//ファイル名のパターン -include,-exclude
+type NameFilter struct {
+	include []string
+	exclude []string
+}
+
+func NewNameFilter(include, exclude string) (*NameFilter, error) {
+	f := &NameFilter{}
+	for _, v := range []struct {
+		spec string
+		list *[]string
+	}{{include, &f.include}, {exclude, &f.exclude}} {
+		for _, pattern := range strings.Split(v.spec, ",") {
+			pattern = strings.ToLower(strings.TrimSpace(pattern))
+			if pattern == "" {
+				continue
+			}
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("%s: %w", pattern, err)
+			}
+			*v.list = append(*v.list, pattern)
+		}
+	}
+	return f, nil
+}
+
+//ZIP内のフォルダは除いたファイル名で比べる 大文字小文字は区別しない
+func (f *NameFilter) match(name string) bool {
+	if f == nil {
+		return true
+	}
+	base := strings.ToLower(path.Base(filepath.ToSlash(name)))
+	for _, pattern := range f.exclude {
+		if ok, _ := path.Match(pattern, base); ok {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, pattern := range f.include {
+		if ok, _ := path.Match(pattern, base); ok {
+			return true
+		}
+	}
+	return false
+}
+
+//スキャン候補のファイル名 拡張子とパターンで絞り込む
+func candidateNames(src imageSource, filter *NameFilter) []string {
+	_, decoder := src.(imageDecoder)
+	var list []string
+	for _, name := range src.Names() {
+		if !decoder && !imageExts[strings.ToLower(path.Ext(name))] {
+			continue
+		}
+		if filter.match(name) {
+			list = append(list, name)
+		}
+	}
+	return list
+}
+
+//数字部分を数値として比較する 2.jpg < 10.jpg
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		ca, cb := a[0], b[0]
+		if isDigit(ca) && isDigit(cb) {
+			na, ra := splitDigits(a)
+			nb, rb := splitDigits(b)
+			//先頭の0を除いて桁数、値の順で比較
+			ta, tb := strings.TrimLeft(na, "0"), strings.TrimLeft(nb, "0")
+			if len(ta) != len(tb) {
+				return len(ta) < len(tb)
+			}
+			if ta != tb {
+				return ta < tb
+			}
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			a, b = ra, rb
+			continue
+		}
+		//日本語の名前も文字単位で比較する
+		ra, sa := utf8.DecodeRuneInString(a)
+		rb, sb := utf8.DecodeRuneInString(b)
+		if la, lb := unicode.ToLower(ra), unicode.ToLower(rb); la != lb {
+			return la < lb
+		}
+		//UTF-8でないバイトはそのまま比較
+		if ra == utf8.RuneError && a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a, b = a[sa:], b[sb:]
+	}
+	return len(a) < len(b)
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func splitDigits(s string) (string, string) {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return s[:i], s[i:]
+}
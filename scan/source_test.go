@@ -0,0 +1,67 @@
+package scan
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestNaturalLess(t *testing.T) {
+	for _, tt := range []struct {
+		names []string
+		want  string
+	}{
+		{[]string{"10.jpg", "2.jpg", "Cover.jpg", "1.jpg", "001_10.jpg", "001_9.jpg", "01.jpg", "a.jpg"},
+			"1.jpg,01.jpg,001_9.jpg,001_10.jpg,2.jpg,10.jpg,a.jpg,Cover.jpg"},
+		{[]string{"裏表紙.jpg", "本文02.jpg", "表紙.jpg", "本文01.jpg"},
+			"本文01.jpg,本文02.jpg,表紙.jpg,裏表紙.jpg"},
+		{[]string{"い10.jpg", "あ10.jpg", "い2.jpg", "あ2.jpg"},
+			"あ2.jpg,あ10.jpg,い2.jpg,い10.jpg"},
+		{[]string{"第10巻_003.jpg", "第2巻_010.jpg", "第2巻_002.jpg", "Vol2.jpg"},
+			"Vol2.jpg,第2巻_002.jpg,第2巻_010.jpg,第10巻_003.jpg"},
+	} {
+		names := tt.names
+		sort.SliceStable(names, func(i, j int) bool {
+			return naturalLess(names[i], names[j])
+		})
+		if got := strings.Join(names, ","); got != tt.want {
+			t.Errorf("sorted = %s, want %s", got, tt.want)
+		}
+	}
+	if naturalLess("あ.jpg", "い.jpg") == naturalLess("い.jpg", "あ.jpg") {
+		t.Error("あ.jpg and い.jpg compare equal")
+	}
+}
+
+func TestCandidateNames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "isbn2title")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"10.jpg", "2.JPG", "000.txt", "Thumbs.db", "1_thumb.jpg", "3.png"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	src, err := newDirSource(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter, err := NewNameFilter("*.jpg", "*_thumb*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(candidateNames(src, filter), ","); got != "2.JPG,10.jpg" {
+		t.Errorf("candidateNames = %s", got)
+	}
+	if got := strings.Join(candidateNames(src, nil), ","); got != "1_thumb.jpg,2.JPG,3.png,10.jpg" {
+		t.Errorf("candidateNames(nil) = %s", got)
+	}
+	if _, err := NewNameFilter("[", ""); err == nil {
+		t.Error("bad pattern accepted")
+	}
+}
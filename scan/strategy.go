@@ -0,0 +1,107 @@
+package scan
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+)
+
+const (
+	strategyRow    = "row"
+	strategyWindow = "window"
+)
+
+var errStrategy = errors.New("-strategyはrowかwindowを指定してください")
+
+//Options.Strategyの名前 空ならrow
+func ParseStrategy(s string) (string, error) {
+	switch s = strings.TrimSpace(strings.ToLower(s)); s {
+	case "", strategyRow:
+		return strategyRow, nil
+	case strategyWindow:
+		return s, nil
+	}
+	return "", fmt.Errorf("%w: %s", errStrategy, s)
+}
+
+//windowで縮小する画像の長辺
+const scanMaxSide = 1600
+
+//-row で上下に分割 全幅
+func rowRects(width, height, row int) []image.Rectangle {
+	cropHeight := height / row
+	if cropHeight < 1 {
+		cropHeight = 1
+	}
+	var rects []image.Rectangle
+	for top := 0; top+cropHeight <= height; top += cropHeight {
+		rects = append(rects, image.Rect(0, top, width, top+cropHeight))
+	}
+	return rects
+}
+
+//半分ずつ重なる窓 全幅の粗い窓から、右寄りの細かい窓の順
+func windowRects(width, height int) []image.Rectangle {
+	var rects []image.Rectangle
+	add := func(h int, xs []int, w int) {
+		if h < 1 {
+			h = 1
+		}
+		step := h / 2
+		if step < 1 {
+			step = 1
+		}
+		for top := 0; top+h <= height; top += step {
+			for _, x := range xs {
+				rects = append(rects, image.Rect(x, top, x+w, top+h))
+			}
+		}
+	}
+	add(height/20, []int{0}, width)
+	//左右の余白や文字を避ける ISBNは右上にあることが多い
+	half := width / 2
+	add(height/40, []int{width - half, (width - half) / 2, 0}, half)
+	return rects
+}
+
+//長辺がmaxSideより大きければ整数分の1に縮小したグレースケール画像 小さければnil
+//JPEGのY成分などから直接平均をとる
+func downscale(img image.Image, maxSide int) *image.Gray {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	long := w
+	if h > long {
+		long = h
+	}
+	if long <= maxSide {
+		return nil
+	}
+	f := (long + maxSide - 1) / maxSide
+
+	//1行分の輝度
+	var buf []byte
+	row := func(y int) []byte {
+		switch src := img.(type) {
+		case *image.Gray:
+			i := (y-src.Rect.Min.Y)*src.Stride + b.Min.X - src.Rect.Min.X
+			return src.Pix[i : i+w]
+		case *image.YCbCr:
+			i := (y-src.Rect.Min.Y)*src.YStride + b.Min.X - src.Rect.Min.X
+			return src.Y[i : i+w]
+		}
+		if buf == nil {
+			buf = make([]byte, w)
+		}
+		for x := 0; x < w; x++ {
+			buf[x] = color.GrayModel.Convert(img.At(b.Min.X+x, y)).(color.Gray).Y
+		}
+		return buf
+	}
+	s := newShrinker(w, h, f)
+	for y := b.Min.Y; y < b.Min.Y+h/f*f; y++ {
+		s.row(row(y))
+	}
+	return s.dst
+}
@@ -0,0 +1,93 @@
+package scan
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math/rand"
+	"testing"
+
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/oned"
+)
+
+//600dpi相当の大きな裏表紙 左側に文字のような模様を置く
+func testScanSet(t testing.TB) []image.Image {
+	rnd := rand.New(rand.NewSource(1))
+	var list []image.Image
+	for i, pos := range []image.Point{{2700, 300}, {2500, 900}, {300, 400}, {2200, 3600}, {1500, 200}, {2600, 5200}} {
+		img := image.NewGray(image.Rect(0, 0, 4000, 6000))
+		draw.Draw(img, img.Bounds(), image.NewUniform(color.Gray{Y: 235}), image.Point{}, draw.Src)
+		//文字の代わり
+		for n := 0; n < 400; n++ {
+			x, y := rnd.Intn(3800), rnd.Intn(5900)
+			if image.Rect(x, y, x+30, y+40).Overlaps(image.Rect(pos.X-100, pos.Y-100, pos.X+1300, pos.Y+800)) {
+				continue
+			}
+			draw.Draw(img, image.Rect(x, y, x+8+rnd.Intn(20), y+40), image.NewUniform(color.Black), image.Point{}, draw.Src)
+		}
+		scale := 8 + i%3*2
+		top := pos.Y
+		for _, code := range []string{"9784088725093", "1920979007000"} {
+			bar, err := oned.NewEAN13Writer().Encode(code, gozxing.BarcodeFormat_EAN_13, 113*scale, 30*scale, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			draw.Draw(img, bar.Bounds().Add(image.Pt(pos.X, top)), bar, image.Point{}, draw.Src)
+			top += 40 * scale
+		}
+		list = append(list, img)
+	}
+	return list
+}
+
+func TestParseStrategy(t *testing.T) {
+	for in, want := range map[string]string{"": "row", "row": "row", "Window": "window"} {
+		if s, err := ParseStrategy(in); err != nil || s != want {
+			t.Errorf("ParseStrategy(%q) = %q, %v", in, s, err)
+		}
+	}
+	if _, err := ParseStrategy("rows"); err == nil {
+		t.Error("ParseStrategy(rows): no error")
+	}
+}
+
+func TestWindowStrategyCoverage(t *testing.T) {
+	if testing.Short() {
+		t.Skip()
+	}
+	set := testScanSet(t)
+	count := func(op *Options) int {
+		n := 0
+		for _, img := range set {
+			if testScan(t, img, op).ISBN != "" {
+				n++
+			}
+		}
+		return n
+	}
+	row := count(&Options{Row: 100, Strategy: strategyRow, NoRotate: true})
+	window := count(&Options{Row: 100, Strategy: strategyWindow, NoRotate: true})
+	if window < row {
+		t.Errorf("window found %d, row found %d", window, row)
+	}
+}
+
+func BenchmarkScanStrategy(b *testing.B) {
+	set := testScanSet(b)
+	for _, strategy := range []string{strategyRow, strategyWindow} {
+		op := &Options{Row: 100, Strategy: strategy, NoRotate: true}
+		b.Run(strategy, func(b *testing.B) {
+			found := 0
+			for i := 0; i < b.N; i++ {
+				found = 0
+				for _, img := range set {
+					if testScan(b, img, op).ISBN != "" {
+						found++
+					}
+				}
+			}
+			b.ReportMetric(float64(found), "found")
+		})
+	}
+}
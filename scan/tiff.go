@@ -0,0 +1,414 @@
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"image"
+	"io"
+	"io/ioutil"
+	"path"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/ccitt"
+	"golang.org/x/image/tiff"
+	"golang.org/x/image/tiff/lzw"
+)
+
+//複数ページのTIFFは2ページ目から "ファイル名#2" の名前で候補にする
+
+var errTIFFPage = errors.New("TIFFのページが見つかりません")
+
+func isTIFF(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".tif", ".tiff":
+		return true
+	}
+	return false
+}
+
+//"name#2" を "name",2 に分ける
+func splitPage(name string) (string, int) {
+	i := strings.LastIndex(name, "#")
+	if i < 0 {
+		return name, 1
+	}
+	n, err := strconv.Atoi(name[i+1:])
+	if err != nil || n < 1 || !isTIFF(name[:i]) {
+		return name, 1
+	}
+	return name[:i], n
+}
+
+//各ページのIFDの位置
+func tiffPages(r io.ReaderAt) (binary.ByteOrder, []int64, error) {
+	p := make([]byte, 8)
+	if _, err := r.ReadAt(p, 0); err != nil {
+		return nil, nil, err
+	}
+	var order binary.ByteOrder
+	switch string(p[0:4]) {
+	case "II\x2A\x00":
+		order = binary.LittleEndian
+	case "MM\x00\x2A":
+		order = binary.BigEndian
+	default:
+		return nil, nil, tiff.FormatError("malformed header")
+	}
+	var pages []int64
+	seen := map[int64]bool{}
+	ifd := int64(order.Uint32(p[4:8]))
+	for ifd != 0 && !seen[ifd] && len(pages) < 10000 {
+		seen[ifd] = true
+		pages = append(pages, ifd)
+		if _, err := r.ReadAt(p[:2], ifd); err != nil {
+			break
+		}
+		n := int64(order.Uint16(p[:2]))
+		if _, err := r.ReadAt(p[:4], ifd+2+n*12); err != nil {
+			break
+		}
+		ifd = int64(order.Uint32(p[:4]))
+	}
+	return order, pages, nil
+}
+
+//ヘッダの最初のIFDの位置だけ書き換えて見せる
+type tiffPageReader struct {
+	r     io.ReaderAt
+	order binary.ByteOrder
+	ifd   int64
+	pos   int64
+}
+
+func (t *tiffPageReader) ReadAt(p []byte, off int64) (int, error) {
+	n, err := t.r.ReadAt(p, off)
+	var header [4]byte
+	t.order.PutUint32(header[:], uint32(t.ifd))
+	for i := 0; i < n; i++ {
+		if pos := off + int64(i); pos >= 4 && pos < 8 {
+			p[i] = header[pos-4]
+		}
+	}
+	return n, err
+}
+
+func (t *tiffPageReader) Read(p []byte) (int, error) {
+	n, err := t.ReadAt(p, t.pos)
+	t.pos += int64(n)
+	return n, err
+}
+
+//ZIPの中身などはメモリに読み込む
+func readerAt(r io.Reader) (io.ReaderAt, error) {
+	if ra, ok := r.(io.ReaderAt); ok {
+		return ra, nil
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+//TIFFのページ数
+func countTIFFPages(src imageSource, name string) (int, error) {
+	fh, err := src.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer fh.Close()
+	ra, err := readerAt(fh)
+	if err != nil {
+		return 0, err
+	}
+	_, pages, err := tiffPages(ra)
+	return len(pages), err
+}
+
+//TIFFの指定ページを開く
+func openTIFFPage(src imageSource, name string, page int) (*tiffPageReader, io.Closer, error) {
+	fh, err := src.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	ra, err := readerAt(fh)
+	if err != nil {
+		fh.Close()
+		return nil, nil, err
+	}
+	order, pages, err := tiffPages(ra)
+	if err != nil {
+		fh.Close()
+		return nil, nil, err
+	}
+	if page > len(pages) {
+		fh.Close()
+		return nil, nil, errTIFFPage
+	}
+	return &tiffPageReader{r: ra, order: order, ifd: pages[page-1]}, fh, nil
+}
+
+func decodeTIFFPage(src imageSource, name string, page int) (image.Image, error) {
+	r, c, err := openTIFFPage(src, name, page)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	return tiff.Decode(r)
+}
+
+func decodeTIFFPageConfig(src imageSource, name string, page int) (image.Config, error) {
+	r, c, err := openTIFFPage(src, name, page)
+	if err != nil {
+		return image.Config{}, err
+	}
+	defer c.Close()
+	return tiff.DecodeConfig(r)
+}
+
+//TIFFのタグ
+const (
+	tiffWidth         = 256
+	tiffHeight        = 257
+	tiffBitsPerSample = 258
+	tiffCompression   = 259
+	tiffPhotometric   = 262
+	tiffFillOrder     = 266
+	tiffStripOffsets  = 273
+	tiffSamples       = 277
+	tiffRowsPerStrip  = 278
+	tiffStripBytes    = 279
+	tiffPlanar        = 284
+	tiffPredictor     = 317
+	tiffColorMap      = 320
+	tiffTileWidth     = 322
+	tiffExtraSamples  = 338
+)
+
+//IFDのBYTE,SHORT,LONGの値
+func readTIFFIFD(r io.ReaderAt, order binary.ByteOrder, ifd int64) (map[int][]uint32, error) {
+	p := make([]byte, 12)
+	if _, err := r.ReadAt(p[:2], ifd); err != nil {
+		return nil, err
+	}
+	tags := map[int][]uint32{}
+	for i, n := 0, int(order.Uint16(p[:2])); i < n; i++ {
+		if _, err := r.ReadAt(p, ifd+2+int64(i)*12); err != nil {
+			return nil, err
+		}
+		tag, typ, count := int(order.Uint16(p[0:2])), order.Uint16(p[2:4]), int(order.Uint32(p[4:8]))
+		size := 0
+		switch typ {
+		case 1:
+			size = 1
+		case 3:
+			size = 2
+		case 4:
+			size = 4
+		}
+		if size == 0 || count > 1<<20 {
+			continue
+		}
+		data := p[8:12]
+		if count*size > 4 {
+			data = make([]byte, count*size)
+			if _, err := r.ReadAt(data, int64(order.Uint32(p[8:12]))); err != nil {
+				return nil, err
+			}
+		}
+		vals := make([]uint32, count)
+		for j := range vals {
+			switch size {
+			case 1:
+				vals[j] = uint32(data[j])
+			case 2:
+				vals[j] = uint32(order.Uint16(data[j*2:]))
+			case 4:
+				vals[j] = order.Uint32(data[j*4:])
+			}
+		}
+		tags[tag] = vals
+	}
+	return tags, nil
+}
+
+//TIFFのページをストリップごとに展開しながら1/fに縮小する
+//タイル、16bit、CMYKなどはerrNoReduce
+func decodeTIFFPageReduced(src imageSource, name string, page, f int) (image.Image, error) {
+	r, c, err := openTIFFPage(src, name, page)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	tags, err := readTIFFIFD(r.r, r.order, r.ifd)
+	if err != nil {
+		return nil, err
+	}
+	first := func(tag int, def uint32) uint32 {
+		if v := tags[tag]; len(v) > 0 {
+			return v[0]
+		}
+		return def
+	}
+	width, height := int(first(tiffWidth, 0)), int(first(tiffHeight, 0))
+	spp := int(first(tiffSamples, 1))
+	if width <= 0 || height <= 0 || width > 1<<24 || height > 1<<24 ||
+		tags[tiffTileWidth] != nil || tags[tiffExtraSamples] != nil || (spp > 1 && first(tiffPlanar, 1) != 1) {
+		return nil, errNoReduce
+	}
+	rf := &rowFormat{comps: 1, bpc: int(first(tiffBitsPerSample, 1))}
+	for _, v := range tags[tiffBitsPerSample] {
+		if int(v) != rf.bpc {
+			return nil, errNoReduce
+		}
+	}
+	switch rf.bpc {
+	case 1, 2, 4, 8:
+	default:
+		return nil, errNoReduce
+	}
+	switch photometric := first(tiffPhotometric, 99); {
+	case photometric <= 1 && spp == 1:
+		rf.invert = photometric == 0
+	case photometric == 2 && spp == 3 && rf.bpc == 8:
+		rf.comps = 3
+	case photometric == 3 && spp == 1:
+		cm := tags[tiffColorMap]
+		n := 1 << uint(rf.bpc)
+		if len(cm) != 3*n {
+			return nil, errNoReduce
+		}
+		rf.palette = make([]uint8, n)
+		for i := range rf.palette {
+			rf.palette[i] = gray16(cm[i], cm[n+i], cm[2*n+i])
+		}
+	default:
+		return nil, errNoReduce
+	}
+	predictor := first(tiffPredictor, 1)
+	if predictor > 2 || (predictor == 2 && rf.bpc != 8) {
+		return nil, errNoReduce
+	}
+	compression := first(tiffCompression, 1)
+	switch compression {
+	case 1, 5, 8, 32946, 32773:
+		if first(tiffFillOrder, 1) != 1 {
+			return nil, errNoReduce
+		}
+	case 3, 4:
+		if rf.bpc != 1 {
+			return nil, errNoReduce
+		}
+	default:
+		return nil, errNoReduce
+	}
+	rps := int(first(tiffRowsPerStrip, uint32(height)))
+	if rps <= 0 || rps > height {
+		rps = height
+	}
+	offsets, counts := tags[tiffStripOffsets], tags[tiffStripBytes]
+	strips := (height + rps - 1) / rps
+	if len(offsets) < strips || len(counts) < strips {
+		return nil, tiff.FormatError("strip")
+	}
+
+	buf := make([]byte, rf.stride(width))
+	lum := make([]byte, width)
+	s := newShrinker(width, height, f)
+	for i := 0; i < strips; i++ {
+		rows := rps
+		if i*rps+rows > height {
+			rows = height - i*rps
+		}
+		sec := io.NewSectionReader(r.r, int64(offsets[i]), int64(counts[i]))
+		var sr io.Reader
+		var closer io.Closer
+		switch compression {
+		case 1:
+			sr = sec
+		case 3, 4:
+			sf, order := ccitt.Group3, ccitt.MSB
+			if compression == 4 {
+				sf = ccitt.Group4
+			}
+			if first(tiffFillOrder, 1) == 2 {
+				order = ccitt.LSB
+			}
+			sr = ccitt.NewReader(sec, order, sf, width, rows, &ccitt.Options{Invert: rf.invert})
+		case 5:
+			lr := lzw.NewReader(sec, lzw.MSB, 8)
+			sr, closer = lr, lr
+		case 8, 32946:
+			zr, err := zlib.NewReader(sec)
+			if err != nil {
+				return nil, err
+			}
+			sr, closer = zr, zr
+		case 32773:
+			sr = &packBitsReader{r: bufio.NewReader(sec)}
+		}
+		for y := 0; y < rows; y++ {
+			if _, err := io.ReadFull(sr, buf); err != nil {
+				return nil, err
+			}
+			if predictor == 2 {
+				for x := rf.comps; x < len(buf); x++ {
+					buf[x] += buf[x-rf.comps]
+				}
+			}
+			rf.lum(lum, buf)
+			s.row(lum)
+		}
+		if closer != nil {
+			closer.Close()
+		}
+	}
+	return s.dst, nil
+}
+
+//PackBitsを少しずつ展開する
+type packBitsReader struct {
+	r   *bufio.Reader
+	lit int //そのまま読む残り
+	run int //繰り返す残り
+	b   byte
+}
+
+func (p *packBitsReader) Read(buf []byte) (int, error) {
+	n := 0
+	for n < len(buf) {
+		switch {
+		case p.lit > 0:
+			c, err := p.r.ReadByte()
+			if err != nil {
+				return n, err
+			}
+			buf[n] = c
+			n++
+			p.lit--
+		case p.run > 0:
+			buf[n] = p.b
+			n++
+			p.run--
+		default:
+			c, err := p.r.ReadByte()
+			if err != nil {
+				return n, err
+			}
+			switch code := int(int8(c)); {
+			case code >= 0:
+				p.lit = code + 1
+			case code != -128:
+				if p.b, err = p.r.ReadByte(); err != nil {
+					return n, err
+				}
+				p.run = 1 - code
+			}
+		}
+	}
+	return n, nil
+}
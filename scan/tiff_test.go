@@ -0,0 +1,84 @@
+package scan
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+//無圧縮グレースケールの複数ページTIFF
+func testTIFF(pages ...*image.Gray) []byte {
+	var buf bytes.Buffer
+	le := binary.LittleEndian
+	buf.WriteString("II\x2A\x00")
+	binary.Write(&buf, le, uint32(8))
+	for i, g := range pages {
+		w, h := g.Rect.Dx(), g.Rect.Dy()
+		const entries = 9
+		ifd := buf.Len()
+		data := ifd + 2 + entries*12 + 4
+		next := uint32(0)
+		if i < len(pages)-1 {
+			next = uint32(data + w*h)
+		}
+		binary.Write(&buf, le, uint16(entries))
+		for _, e := range [][3]uint32{
+			{256, 4, uint32(w)}, {257, 4, uint32(h)}, {258, 3, 8}, {259, 3, 1}, {262, 3, 1},
+			{273, 4, uint32(data)}, {277, 3, 1}, {278, 4, uint32(h)}, {279, 4, uint32(w * h)},
+		} {
+			binary.Write(&buf, le, uint16(e[0]))
+			binary.Write(&buf, le, uint16(e[1]))
+			binary.Write(&buf, le, uint32(1))
+			if e[1] == 3 {
+				binary.Write(&buf, le, uint16(e[2]))
+				binary.Write(&buf, le, uint16(0))
+			} else {
+				binary.Write(&buf, le, e[2])
+			}
+		}
+		binary.Write(&buf, le, next)
+		for y := 0; y < h; y++ {
+			buf.Write(g.Pix[y*g.Stride : y*g.Stride+w])
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestMultiPageTIFF(t *testing.T) {
+	dir, err := ioutil.TempDir("", "isbn2title")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	blank := testCover(t)
+	data := testTIFF(blank, blank, testCover(t, "9784088725093"))
+	if err := ioutil.WriteFile(filepath.Join(dir, "scan.tif"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	src, err := newDirSource(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(imagePages(src, "scan.tif", &Options{}), ","); got != "scan.tif,scan.tif#2,scan.tif#3" {
+		t.Errorf("imagePages = %s", got)
+	}
+	cfg, err := decodeImageConfig(src, "scan.tif#3")
+	if err != nil || cfg.Width != 800 {
+		t.Errorf("DecodeConfig = %v, %v", cfg, err)
+	}
+	//tailの1枚目は最後のページ
+	op := &Options{Row: 100, Head: 0, Tail: 1, Jobs: 1, NoRotate: true}
+	if res := testCheckDir(t, src, op); res.ISBN != "9784088725093" {
+		t.Errorf("ISBN = %q", res.ISBN)
+	}
+	op = &Options{Row: 100, Head: 2, Tail: 0, Jobs: 1, NoRotate: true}
+	if res := testCheckDir(t, src, op); res.ISBN != "" {
+		t.Errorf("head 2 found %q", res.ISBN)
+	}
+}